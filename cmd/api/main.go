@@ -7,11 +7,17 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/Kir-Khorev/finopp-back/internal/account"
+	"github.com/Kir-Khorev/finopp-back/internal/admin"
 	"github.com/Kir-Khorev/finopp-back/internal/advice"
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
 	"github.com/Kir-Khorev/finopp-back/internal/auth"
 	"github.com/Kir-Khorev/finopp-back/internal/common"
 	"github.com/Kir-Khorev/finopp-back/internal/currency"
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
 	appMiddleware "github.com/Kir-Khorev/finopp-back/internal/middleware"
+	"github.com/Kir-Khorev/finopp-back/internal/passwords"
+	"github.com/Kir-Khorev/finopp-back/internal/profile"
 	"github.com/Kir-Khorev/finopp-back/pkg/config"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -20,6 +26,9 @@ import (
 func main() {
 	// Load config
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid config:", err)
+	}
 
 	// Initialize database
 	db, err := common.InitDB(cfg)
@@ -40,6 +49,13 @@ func main() {
 	// Setup Echo
 	e := echo.New()
 	e.HideBanner = true
+
+	// Client IP for lockouts, rate limits and audit: X-Forwarded-For only from trusted proxies
+	ipExtractor, err := appMiddleware.IPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	e.IPExtractor = ipExtractor
 	
 	// Custom error handler
 	e.HTTPErrorHandler = appMiddleware.ErrorHandler
@@ -55,8 +71,9 @@ func main() {
 			"http://localhost:5173", // Vite dev server
 			"http://localhost:8081", // Vite dev server (alternative port)
 		},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"Content-Disposition"},
 		AllowCredentials: true,
 		MaxAge:           86400, // 24 hours
 	}))
@@ -71,33 +88,154 @@ func main() {
 
 	// Initialize Auth
 	authRepo := auth.NewRepository(db)
-	authService := auth.NewService(authRepo, cfg.JWTSecret)
-	authHandler := auth.NewHandler(authService)
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to init mailer:", err)
+	}
+	jwtKeys, err := auth.NewKeyManager(cfg.JWTKeysDir, cfg.JWTSigningKeyID, cfg.JWTSecret)
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	passwordPolicy, err := passwords.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to init password policy:", err)
+	}
+	auditRepo := audit.NewRepository(db)
+	authService := auth.NewService(authRepo, rdb, mail, jwtKeys, auditRepo, passwordPolicy, auth.Config{
+		Issuer:          cfg.JWTIssuer,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		AppBaseURL:      cfg.AppBaseURL,
+		OAuthProviders:  oauthProviders(cfg),
+		EventRetention:  cfg.AuthEventsRetention,
+	})
+	authHandler := auth.NewHandler(authService, cfg.Environment != "development")
+
+	// Initialize Admin
+	adminService := admin.NewService(admin.NewRepository(db), auditRepo, authService)
+	adminHandler := admin.NewHandler(adminService)
+	if err := adminService.BootstrapAdmins(context.Background(), cfg.AdminEmails); err != nil {
+		log.Fatal("Failed to bootstrap admins:", err)
+	}
+
+	// Initialize Account (data export and deletion)
+	accountService := account.NewService(account.NewRepository(db), auditRepo, authService, mail, account.Config{
+		DeletionGracePeriod: cfg.AccountDeletionGrace,
+	})
+	accountHandler := account.NewHandler(accountService)
+
+	// Initialize Profile
+	profileRepo := profile.NewRepository(db)
+	profileService := profile.NewService(profileRepo)
+	profileHandler := profile.NewHandler(profileService)
 
 	// Initialize Currency Converter
-	currencyService := currency.NewService(cfg.FixerAPIKey, rdb)
+	currencyService := currency.NewService(cfg.FixerAPIKey, rdb, cfg.CurrencyTimeout)
 
 	// Initialize Advice
-	adviceService := advice.NewService(cfg.GroqAPIKey, currencyService)
-	adviceHandler := advice.NewHandler(adviceService)
+	llmProvider, err := advice.NewProvider(cfg)
+	if err != nil {
+		log.Fatal("Failed to init LLM provider:", err)
+	}
+	var adviceTools *advice.Toolbox
+	if cfg.LLMTools {
+		adviceTools = advice.NewToolbox(currencyService)
+	}
+	adviceRepo := advice.NewRepository(db)
+	adviceService := advice.NewService(llmProvider, currencyService, adviceRepo, profileService, adviceTools)
+	adviceHandler := advice.NewHandler(adviceService, cfg.RequireVerifiedEmail, advice.Timeouts{
+		Advice:  cfg.AdviceTimeout,
+		Analyze: cfg.AnalyzeTimeout,
+		Stream:  cfg.AdviceStreamTimeout,
+	})
+
+	// Public keys for verifying our JWTs in other services
+	e.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// API routes
 	api := e.Group("/api/v1")
+	requireAuth := appMiddleware.AuthMiddleware(authService)
+	optionalAuth := appMiddleware.OptionalAuthMiddleware(authService)
 	
 	// Public auth routes
+	// Account management is available only after a regular login, not with an API key
+	requireLogin := []echo.MiddlewareFunc{requireAuth, appMiddleware.RejectAPIKeys()}
 	auth := api.Group("/auth")
 	auth.POST("/register", authHandler.Register)
 	auth.POST("/login", authHandler.Login)
+	auth.POST("/refresh", authHandler.Refresh)
+	auth.POST("/logout", authHandler.Logout, requireLogin...)
+	auth.POST("/password/forgot", authHandler.ForgotPassword)
+	auth.POST("/password/reset", authHandler.ResetPassword)
+	auth.GET("/verify", authHandler.VerifyEmail)
+	auth.POST("/verify/resend", authHandler.ResendVerification, requireLogin...)
+	auth.POST("/magic-link", authHandler.RequestMagicLink)
+	auth.GET("/magic-link/consume", authHandler.ConsumeMagicLink)
+	auth.GET("/oauth/providers", authHandler.OAuthProviders)
+	auth.GET("/oauth/:provider/start", authHandler.StartOAuth)
+	auth.POST("/oauth/:provider/callback", authHandler.OAuthCallback)
+	auth.POST("/mfa/verify", authHandler.VerifyMFA)
+	auth.POST("/mfa/totp/enroll", authHandler.EnrollTOTP, requireLogin...)
+	auth.POST("/mfa/totp/confirm", authHandler.ConfirmTOTP, requireLogin...)
+	auth.POST("/mfa/totp/disable", authHandler.DisableTOTP, requireLogin...)
+	auth.GET("/api-keys", authHandler.ListAPIKeys, requireLogin...)
+	auth.POST("/api-keys", authHandler.CreateAPIKey, requireLogin...)
+	auth.DELETE("/api-keys/:id", authHandler.RevokeAPIKey, requireLogin...)
+	auth.GET("/sessions", authHandler.ListSessions, requireLogin...)
+	auth.POST("/sessions/revoke-others", authHandler.RevokeOtherSessions, requireLogin...)
+	auth.DELETE("/sessions/:id", authHandler.RevokeSession, requireLogin...)
+	auth.PUT("/password", authHandler.ChangePassword, requireLogin...)
+	auth.PUT("/email", authHandler.ChangeEmail, requireLogin...)
+	auth.GET("/email/confirm", authHandler.ConfirmEmailChange)
 
 	// Public advice routes (опционально можно защитить через middleware)
-	api.POST("/advice", adviceHandler.GetAdvice, appMiddleware.OptionalAuthMiddleware(cfg.JWTSecret))
-	api.POST("/advice/structured", adviceHandler.GetStructuredAdvice, appMiddleware.OptionalAuthMiddleware(cfg.JWTSecret))
-	api.POST("/analyze", adviceHandler.Analyze, appMiddleware.OptionalAuthMiddleware(cfg.JWTSecret))
+	adviceScope := appMiddleware.RequireScope(appMiddleware.ScopeAdviceWrite)
+	api.POST("/advice", adviceHandler.GetAdvice, optionalAuth, adviceScope)
+	api.POST("/advice/structured", adviceHandler.GetStructuredAdvice, optionalAuth, adviceScope)
+	api.POST("/advice/stream", adviceHandler.StreamAdvice, optionalAuth, adviceScope)
+	api.POST("/advice/structured/stream", adviceHandler.StreamStructuredAdvice, optionalAuth, adviceScope)
+	api.POST("/analyze", adviceHandler.Analyze, optionalAuth, adviceScope)
 	
-	// Protected routes example (раскомментировать когда добавятся эндпоинты)
-	// protected := api.Group("")
-	// protected.Use(appMiddleware.AuthMiddleware(cfg.JWTSecret))
-	// protected.GET("/profile", profileHandler.GetProfile)
+	// Protected routes
+	protected := api.Group("")
+	protected.Use(requireAuth)
+	requireVerified := appMiddleware.RequireVerifiedEmail(cfg.RequireVerifiedEmail)
+	scope := appMiddleware.RequireScope
+	protected.GET("/profile", profileHandler.GetProfile, scope(appMiddleware.ScopeProfileRead))
+	protected.PUT("/profile", profileHandler.UpdateProfile, scope(appMiddleware.ScopeProfileWrite), requireVerified)
+	protected.GET("/sessions", adviceHandler.ListSessions, scope(appMiddleware.ScopeSessionsRead))
+	protected.GET("/sessions/:id", adviceHandler.GetSession, scope(appMiddleware.ScopeSessionsRead))
+	protected.PATCH("/sessions/:id", adviceHandler.RenameSession, scope(appMiddleware.ScopeSessionsWrite), requireVerified)
+	protected.DELETE("/sessions/:id", adviceHandler.DeleteSession, scope(appMiddleware.ScopeSessionsWrite))
+	protected.GET("/sessions/:id/export", adviceHandler.ExportSession, scope(appMiddleware.ScopeSessionsRead))
+	protected.POST("/sessions/:id/messages", adviceHandler.FollowUp, scope(appMiddleware.ScopeSessionsWrite), requireVerified)
+
+	// Account routes (personal data export, account deletion, security events)
+	me := api.Group("/me", requireLogin...)
+	me.GET("/export", accountHandler.Export)
+	me.DELETE("", accountHandler.DeleteAccount)
+	me.GET("/deletion", accountHandler.GetDeletion)
+	me.DELETE("/deletion", accountHandler.CancelDeletion)
+	me.GET("/security-events", authHandler.ListSecurityEvents)
+
+	// Admin routes (permissions come from the role in the access token)
+	adminGroup := api.Group("/admin", requireLogin...)
+	perm := appMiddleware.RequirePermission
+	adminGroup.GET("/users", adminHandler.ListUsers, perm(appMiddleware.PermUsersRead))
+	adminGroup.GET("/users/:id", adminHandler.GetUser, perm(appMiddleware.PermUsersRead))
+	adminGroup.POST("/users/:id/disable", adminHandler.DisableUser, perm(appMiddleware.PermUsersDisable))
+	adminGroup.POST("/users/:id/enable", adminHandler.EnableUser, perm(appMiddleware.PermUsersDisable))
+	adminGroup.POST("/users/:id/logout", adminHandler.ForceLogout, perm(appMiddleware.PermUsersLogout))
+	adminGroup.PUT("/users/:id/role", adminHandler.SetRole, perm(appMiddleware.PermUsersRoles))
+	adminGroup.GET("/stats/advice", adminHandler.AdviceUsage, perm(appMiddleware.PermStatsRead))
+	adminGroup.GET("/audit", adminHandler.ListAudit, perm(appMiddleware.PermAuditRead))
+	adminGroup.GET("/metrics", adminHandler.Metrics, perm(appMiddleware.PermStatsRead))
+
+	// Background jobs: purge deleted accounts, expired exports and old auth events
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go accountService.Run(jobsCtx, time.Hour)
+	go authService.Run(jobsCtx, time.Hour)
 
 	// Start server
 	go func() {
@@ -113,6 +251,7 @@ func main() {
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 
+	stopJobs()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -123,3 +262,17 @@ func main() {
 	log.Println("Server exited properly")
 }
 
+// oauthProviders enables social login providers that have a client id configured
+func oauthProviders(cfg *config.Config) []auth.OAuthProvider {
+	var providers []auth.OAuthProvider
+	if cfg.GoogleClientID != "" {
+		providers = append(providers, auth.GoogleProvider(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.OAuthRedirectBaseURL))
+	}
+	if cfg.YandexClientID != "" {
+		providers = append(providers, auth.YandexProvider(cfg.YandexClientID, cfg.YandexClientSecret, cfg.OAuthRedirectBaseURL))
+	}
+	if cfg.VKClientID != "" {
+		providers = append(providers, auth.VKProvider(cfg.VKClientID, cfg.VKClientSecret, cfg.OAuthRedirectBaseURL))
+	}
+	return providers
+}
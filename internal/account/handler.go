@@ -0,0 +1,66 @@
+package account
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// Export отдаёт ZIP с данными пользователя, а пока архив собирается — 202 со статусом
+func (h *Handler) Export(c echo.Context) error {
+	export, archive, err := h.service.Export(c.Request().Context(), middleware.GetPrincipal(c), c.RealIP())
+	if err != nil {
+		return err
+	}
+
+	if archive == nil {
+		return c.JSON(http.StatusAccepted, export)
+	}
+
+	filename := fmt.Sprintf("finopp-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	return c.Blob(200, "application/zip", archive)
+}
+
+// DeleteAccount назначает удаление аккаунта; требует пароль
+func (h *Handler) DeleteAccount(c echo.Context) error {
+	var req DeleteAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	resp, err := h.service.RequestDeletion(c.Request().Context(), middleware.GetPrincipal(c), c.RealIP(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, resp)
+}
+
+func (h *Handler) GetDeletion(c echo.Context) error {
+	resp, err := h.service.GetDeletion(c.Request().Context(), c.Get("user_id").(int))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+func (h *Handler) CancelDeletion(c echo.Context) error {
+	if err := h.service.CancelDeletion(c.Request().Context(), middleware.GetPrincipal(c), c.RealIP()); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
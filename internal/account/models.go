@@ -0,0 +1,35 @@
+package account
+
+import "time"
+
+// Состояния выгрузки данных
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Export — выгрузка персональных данных пользователя
+type Export struct {
+	ID          int        `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// DeleteAccountRequest — запрос на удаление аккаунта, пароль подтверждает намерение
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// DeletionResponse — когда аккаунт будет удалён окончательно
+type DeletionResponse struct {
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
+
+// pendingDeletion — аккаунт, у которого истёк срок на отмену удаления
+type pendingDeletion struct {
+	UserID int
+	Email  string
+}
@@ -0,0 +1,329 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrExportNotFound     = errors.New("export not found")
+	ErrDeletionNotPending = errors.New("account deletion is not scheduled")
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// exportFile — один JSON-файл архива выгрузки
+type exportFile struct {
+	Name string
+	Data json.RawMessage
+}
+
+// exportQueries собирают данные пользователя ($1 — id) сразу в JSON.
+// Секреты (хеши паролей и токенов, TOTP) в выгрузку не попадают
+var exportQueries = []struct {
+	file  string
+	query string
+}{
+	{"user.json", `
+		SELECT row_to_json(t) FROM (
+			SELECT id, email, name, role, created_at AS "createdAt", updated_at AS "updatedAt",
+			       email_verified_at AS "emailVerifiedAt", totp_enabled_at AS "mfaEnabledAt",
+			       deletion_scheduled_at AS "deletionScheduledAt"
+			FROM users WHERE id = $1
+		) t`},
+	{"profile.json", `
+		SELECT row_to_json(t) FROM (
+			SELECT monthly_income AS "monthlyIncome", monthly_expenses AS "monthlyExpenses",
+			       savings_goal AS "savingsGoal", debt_amount AS "debtAmount", currency,
+			       created_at AS "createdAt", updated_at AS "updatedAt"
+			FROM profiles WHERE user_id = $1
+		) t`},
+	{"advice_sessions.json", `
+		SELECT COALESCE(json_agg(t ORDER BY t.id), '[]') FROM (
+			SELECT s.id, s.title, s.context_snapshot AS "contextSnapshot", s.created_at AS "createdAt",
+			       COALESCE((
+			           SELECT json_agg(json_build_object('role', m.role, 'content', m.content, 'createdAt', m.created_at) ORDER BY m.id)
+			           FROM advice_messages m WHERE m.session_id = s.id
+			       ), '[]') AS messages
+			FROM advice_sessions s WHERE s.user_id = $1
+		) t`},
+	{"login_sessions.json", `
+		SELECT COALESCE(json_agg(t ORDER BY t."createdAt"), '[]') FROM (
+			SELECT user_agent AS "userAgent", ip, created_at AS "createdAt", last_seen_at AS "lastSeenAt",
+			       expires_at AS "expiresAt", revoked_at AS "revokedAt"
+			FROM user_sessions WHERE user_id = $1
+		) t`},
+	{"linked_accounts.json", `
+		SELECT COALESCE(json_agg(t ORDER BY t."createdAt"), '[]') FROM (
+			SELECT provider, email, created_at AS "createdAt"
+			FROM user_identities WHERE user_id = $1
+		) t`},
+	{"api_keys.json", `
+		SELECT COALESCE(json_agg(t ORDER BY t."createdAt"), '[]') FROM (
+			SELECT name, prefix, scopes, created_at AS "createdAt", last_used_at AS "lastUsedAt",
+			       expires_at AS "expiresAt", revoked_at AS "revokedAt"
+			FROM api_keys WHERE user_id = $1
+		) t`},
+	{"security_events.json", `
+		SELECT COALESCE(json_agg(t ORDER BY t.id), '[]') FROM (
+			SELECT id, event_type AS "type", outcome, ip, user_agent AS "userAgent", details,
+			       created_at AS "createdAt"
+			FROM auth_events WHERE user_id = $1
+		) t`},
+}
+
+// ExportData собирает все персональные данные пользователя по файлам
+func (r *Repository) ExportData(ctx context.Context, userID int) ([]exportFile, error) {
+	files := make([]exportFile, 0, len(exportQueries))
+	for _, q := range exportQueries {
+		var data []byte
+		err := r.db.QueryRowContext(ctx, q.query, userID).Scan(&data)
+		if err == sql.ErrNoRows {
+			data = []byte("null") // например, профиль ещё не заполнен
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", q.file, err)
+		}
+		files = append(files, exportFile{Name: q.file, Data: data})
+	}
+	return files, nil
+}
+
+// CreateExport заводит выгрузку в состоянии pending
+func (r *Repository) CreateExport(ctx context.Context, userID int) (*Export, error) {
+	export := Export{Status: ExportPending}
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO data_exports (user_id, status) VALUES ($1, $2)
+		 RETURNING id, created_at`,
+		userID, ExportPending,
+	).Scan(&export.ID, &export.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+	return &export, nil
+}
+
+// LatestExport возвращает последнюю выгрузку пользователя
+func (r *Repository) LatestExport(ctx context.Context, userID int) (*Export, error) {
+	var export Export
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, status, created_at, completed_at, expires_at
+		 FROM data_exports
+		 WHERE user_id = $1
+		 ORDER BY id DESC
+		 LIMIT 1`,
+		userID,
+	).Scan(&export.ID, &export.Status, &export.CreatedAt, &export.CompletedAt, &export.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+	return &export, nil
+}
+
+// GetExportArchive возвращает готовый архив, если он ещё не истёк
+func (r *Repository) GetExportArchive(ctx context.Context, userID, exportID int) ([]byte, error) {
+	var archive []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT archive FROM data_exports
+		 WHERE id = $1 AND user_id = $2 AND status = $3 AND expires_at > CURRENT_TIMESTAMP`,
+		exportID, userID, ExportReady,
+	).Scan(&archive)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export archive: %w", err)
+	}
+	return archive, nil
+}
+
+// CompleteExport сохраняет готовый архив
+func (r *Repository) CompleteExport(ctx context.Context, exportID int, archive []byte, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE data_exports
+		 SET status = $2, archive = $3, completed_at = CURRENT_TIMESTAMP, expires_at = $4
+		 WHERE id = $1`,
+		exportID, ExportReady, archive, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete export: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) FailExport(ctx context.Context, exportID int) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE data_exports SET status = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		exportID, ExportFailed,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark export failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredExports удаляет истёкшие архивы и зависшие выгрузки
+func (r *Repository) DeleteExpiredExports(ctx context.Context, stuckAfter time.Duration) (int64, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM data_exports
+		 WHERE expires_at <= CURRENT_TIMESTAMP
+		    OR (status <> $1 AND created_at < $2)`,
+		ExportReady, time.Now().Add(-stuckAfter),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired exports: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ScheduleDeletion назначает удаление аккаунта. Повторный запрос срок не сдвигает
+func (r *Repository) ScheduleDeletion(ctx context.Context, userID int, at time.Time) (time.Time, error) {
+	var scheduledAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE users SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, $2)
+		 WHERE id = $1
+		 RETURNING deletion_scheduled_at`,
+		userID, at,
+	).Scan(&scheduledAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrUserNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+	return scheduledAt, nil
+}
+
+// GetDeletion возвращает назначенное время удаления
+func (r *Repository) GetDeletion(ctx context.Context, userID int) (time.Time, error) {
+	var scheduledAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT deletion_scheduled_at FROM users WHERE id = $1`,
+		userID,
+	).Scan(&scheduledAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrUserNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get deletion: %w", err)
+	}
+	if !scheduledAt.Valid {
+		return time.Time{}, ErrDeletionNotPending
+	}
+	return scheduledAt.Time, nil
+}
+
+func (r *Repository) CancelDeletion(ctx context.Context, userID int) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET deletion_scheduled_at = NULL
+		 WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deletion: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeletionNotPending
+	}
+	return nil
+}
+
+// DueDeletions возвращает аккаунты, срок отмены удаления которых истёк
+func (r *Repository) DueDeletions(ctx context.Context, limit int) ([]pendingDeletion, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, email FROM users
+		 WHERE deletion_scheduled_at <= CURRENT_TIMESTAMP
+		 ORDER BY deletion_scheduled_at
+		 LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due deletions: %w", err)
+	}
+	defer rows.Close()
+
+	var due []pendingDeletion
+	for rows.Next() {
+		var d pendingDeletion
+		if err := rows.Scan(&d.UserID, &d.Email); err != nil {
+			return nil, fmt.Errorf("failed to scan due deletion: %w", err)
+		}
+		due = append(due, d)
+	}
+	return due, rows.Err()
+}
+
+// PurgeUser окончательно удаляет аккаунт, оставляя надгробие с хешем email.
+// Связанные данные удаляются каскадно, записи аудита обезличиваются,
+// а email снова можно зарегистрировать.
+// Возвращает false, если удаление успели отменить
+func (r *Repository) PurgeUser(ctx context.Context, userID int, email string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO deleted_users (user_id, email_hash, registered_at)
+		 SELECT id, $2, created_at FROM users
+		 WHERE id = $1 AND deletion_scheduled_at <= CURRENT_TIMESTAMP
+		 ON CONFLICT (user_id) DO NOTHING`,
+		userID, emailHash(email),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to write tombstone: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	// Журнал аудита переживает удаление аккаунта, поэтому из него убираются
+	// персональные данные: IP пользователя, детали записей о нём (адреса из смены
+	// email, причины блокировки) и записи, где упоминается его email (поиск в админке)
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE audit_log
+		 SET ip = CASE WHEN actor_id = $1 THEN NULL ELSE ip END,
+		     details = CASE WHEN target_user_id = $1 OR position($2 IN LOWER(details::text)) > 0
+		                    THEN NULL ELSE details END
+		 WHERE actor_id = $1 OR target_user_id = $1 OR position($2 IN LOWER(details::text)) > 0`,
+		userID, strings.ToLower(strings.TrimSpace(email)),
+	); err != nil {
+		return false, fmt.Errorf("failed to scrub audit log: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// emailHash — SHA-256 нормализованного email для надгробия удалённого аккаунта
+func emailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
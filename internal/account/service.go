@@ -0,0 +1,285 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// Действия с аккаунтом в журнале аудита
+const (
+	ActionExport          = "account.export"
+	ActionDeletionRequest = "account.delete.request"
+	ActionDeletionCancel  = "account.delete.cancel"
+	ActionPurge           = "account.purge"
+)
+
+const (
+	exportTTL = 24 * time.Hour // сколько хранится готовый архив
+	// exportTimeout ограничивает сборку архива; незавершённая за это время
+	// выгрузка считается потерянной (например, сервер перезапустился)
+	exportTimeout  = 5 * time.Minute
+	purgeBatchSize = 100
+	mailTimeout    = 30 * time.Second
+)
+
+var errDeletionNotPending = apperrors.New(http.StatusConflict, "Удаление аккаунта не запланировано")
+
+// Authenticator — операции auth, нужные для удаления аккаунта; реализуется auth.Service
+type Authenticator interface {
+	ConfirmPassword(ctx context.Context, userID int, email, password string) error
+	LogoutEverywhere(ctx context.Context, userID int) error
+	ForgetUser(ctx context.Context, userID int, email string) error
+}
+
+// Config — сроки хранения данных
+type Config struct {
+	// DeletionGracePeriod — сколько времени можно отменить удаление аккаунта
+	DeletionGracePeriod time.Duration
+}
+
+type Service struct {
+	repo   *Repository
+	audit  *audit.Repository
+	auth   Authenticator
+	mailer mailer.Mailer
+	cfg    Config
+}
+
+func NewService(repo *Repository, audit *audit.Repository, auth Authenticator, mailer mailer.Mailer, cfg Config) *Service {
+	return &Service{
+		repo:   repo,
+		audit:  audit,
+		auth:   auth,
+		mailer: mailer,
+		cfg:    cfg,
+	}
+}
+
+// Export возвращает готовый архив с данными пользователя. Если архива нет,
+// запускает его сборку в фоне и возвращает выгрузку в состоянии pending
+func (s *Service) Export(ctx context.Context, principal *middleware.Principal, ip string) (*Export, []byte, error) {
+	latest, err := s.repo.LatestExport(ctx, principal.UserID)
+	switch {
+	case errors.Is(err, ErrExportNotFound):
+	case err != nil:
+		return nil, nil, apperrors.Wrap(err, "Ошибка загрузки выгрузки")
+	case latest.Status == ExportReady && latest.ExpiresAt != nil && latest.ExpiresAt.After(time.Now()):
+		archive, err := s.repo.GetExportArchive(ctx, principal.UserID, latest.ID)
+		if err == nil {
+			return latest, archive, nil
+		}
+		if !errors.Is(err, ErrExportNotFound) {
+			return nil, nil, apperrors.Wrap(err, "Ошибка загрузки выгрузки")
+		}
+	case latest.Status == ExportPending && time.Since(latest.CreatedAt) < exportTimeout:
+		return latest, nil, nil
+	}
+
+	export, err := s.repo.CreateExport(ctx, principal.UserID)
+	if err != nil {
+		return nil, nil, apperrors.Wrap(err, "Ошибка создания выгрузки")
+	}
+	if err := s.record(ctx, principal.UserID, ActionExport, ip, map[string]any{"exportId": export.ID}); err != nil {
+		return nil, nil, err
+	}
+
+	go s.buildExport(export.ID, principal.UserID, principal.Email)
+	return export, nil, nil
+}
+
+func (s *Service) buildExport(exportID, userID int, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	archive, err := s.buildArchive(ctx, userID)
+	if err == nil {
+		err = s.repo.CompleteExport(ctx, exportID, archive, time.Now().Add(exportTTL))
+	}
+	if err != nil {
+		log.Printf("Failed to build export %d for user %d: %v", exportID, userID, err)
+		if err := s.repo.FailExport(context.Background(), exportID); err != nil {
+			log.Printf("Failed to mark export %d failed: %v", exportID, err)
+		}
+		return
+	}
+
+	s.sendMail(email, "Ваши данные готовы к скачиванию", fmt.Sprintf(`Здравствуйте!
+
+Архив с вашими данными из Finopp собран. Скачайте его в настройках аккаунта
+в течение %d часов, после этого архив будет удалён.
+
+Если вы не запрашивали выгрузку, смените пароль и завершите чужие сессии.`, int(exportTTL.Hours())))
+}
+
+// buildArchive упаковывает данные пользователя в ZIP из JSON-файлов
+func (s *Service) buildArchive(ctx context.Context, userID int) ([]byte, error) {
+	files, err := s.repo.ExportData(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", file.Name, err)
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, file.Data, "", "  "); err != nil {
+			return nil, fmt.Errorf("failed to format %s: %w", file.Name, err)
+		}
+		if _, err := w.Write(pretty.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RequestDeletion назначает удаление аккаунта после подтверждения пароля
+// и сразу завершает все входы. До окончания срока удаление можно отменить
+func (s *Service) RequestDeletion(ctx context.Context, principal *middleware.Principal, ip string, req DeleteAccountRequest) (*DeletionResponse, error) {
+	if err := s.auth.ConfirmPassword(ctx, principal.UserID, principal.Email, req.Password); err != nil {
+		return nil, err
+	}
+
+	scheduledAt, err := s.repo.ScheduleDeletion(ctx, principal.UserID, time.Now().Add(s.cfg.DeletionGracePeriod))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, apperrors.ErrNotFound
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка удаления аккаунта")
+	}
+
+	if err := s.auth.LogoutEverywhere(ctx, principal.UserID); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, principal.UserID, ActionDeletionRequest, ip, map[string]any{"scheduledAt": scheduledAt}); err != nil {
+		return nil, err
+	}
+
+	go s.sendMail(principal.Email, "Аккаунт Finopp будет удалён", fmt.Sprintf(`Здравствуйте!
+
+Вы запросили удаление аккаунта Finopp. Все ваши данные будут удалены
+без возможности восстановления %s (UTC).
+
+До этого момента удаление можно отменить: войдите в аккаунт и отмените
+удаление в настройках. Если это были не вы, срочно войдите и смените пароль.`,
+		scheduledAt.UTC().Format("02.01.2006 15:04")))
+
+	return &DeletionResponse{DeletionScheduledAt: scheduledAt}, nil
+}
+
+// GetDeletion возвращает назначенное время удаления аккаунта
+func (s *Service) GetDeletion(ctx context.Context, userID int) (*DeletionResponse, error) {
+	scheduledAt, err := s.repo.GetDeletion(ctx, userID)
+	if errors.Is(err, ErrDeletionNotPending) || errors.Is(err, ErrUserNotFound) {
+		return nil, errDeletionNotPending
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки аккаунта")
+	}
+	return &DeletionResponse{DeletionScheduledAt: scheduledAt}, nil
+}
+
+// CancelDeletion отменяет запланированное удаление аккаунта
+func (s *Service) CancelDeletion(ctx context.Context, principal *middleware.Principal, ip string) error {
+	err := s.repo.CancelDeletion(ctx, principal.UserID)
+	if errors.Is(err, ErrDeletionNotPending) {
+		return errDeletionNotPending
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка отмены удаления")
+	}
+
+	return s.record(ctx, principal.UserID, ActionDeletionCancel, ip, nil)
+}
+
+// PurgeDeleted окончательно удаляет аккаунты, срок отмены удаления которых истёк
+func (s *Service) PurgeDeleted(ctx context.Context) error {
+	due, err := s.repo.DueDeletions(ctx, purgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		purged, err := s.repo.PurgeUser(ctx, d.UserID, d.Email)
+		if err != nil {
+			return err
+		}
+		if !purged {
+			continue // удаление отменили в последний момент
+		}
+
+		if err := s.auth.ForgetUser(ctx, d.UserID, d.Email); err != nil {
+			log.Printf("Failed to clean up Redis for deleted user %d: %v", d.UserID, err)
+		}
+		// Пользователя уже нет, поэтому id сохраняется в деталях, а не в target_user_id
+		if err := s.audit.Record(ctx, audit.Entry{Action: ActionPurge, Details: map[string]any{"userId": d.UserID}}); err != nil {
+			log.Printf("Failed to audit purge of user %d: %v", d.UserID, err)
+		}
+		log.Printf("Account %d deleted", d.UserID)
+	}
+	return nil
+}
+
+// Run периодически удаляет аккаунты с истёкшим сроком отмены
+// и устаревшие архивы выгрузок, пока не отменён ctx
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PurgeDeleted(ctx); err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		}
+		if _, err := s.repo.DeleteExpiredExports(ctx, exportTimeout); err != nil {
+			log.Printf("Failed to delete expired exports: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) record(ctx context.Context, userID int, action, ip string, details map[string]any) error {
+	err := s.audit.Record(ctx, audit.Entry{
+		ActorID:      userID,
+		Action:       action,
+		TargetUserID: userID,
+		IP:           ip,
+		Details:      details,
+	})
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка записи в журнал аудита")
+	}
+	return nil
+}
+
+func (s *Service) sendMail(to, subject, body string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	if err := s.mailer.Send(ctx, mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+		log.Printf("Failed to send account email: %v", err)
+	}
+}
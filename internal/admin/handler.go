@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// ListUsers — GET /admin/users?q=&cursor=&limit=
+func (h *Handler) ListUsers(c echo.Context) error {
+	limit, err := queryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.service.ListUsers(c.Request().Context(), actor(c), c.QueryParam("q"), c.QueryParam("cursor"), limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result)
+}
+
+func (h *Handler) GetUser(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	result, err := h.service.GetUser(c.Request().Context(), actor(c), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result)
+}
+
+func (h *Handler) DisableUser(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	var req DisableUserRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.DisableUser(c.Request().Context(), actor(c), userID, req.Reason); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) EnableUser(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	if err := h.service.EnableUser(c.Request().Context(), actor(c), userID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) ForceLogout(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	if err := h.service.ForceLogout(c.Request().Context(), actor(c), userID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) SetRole(c echo.Context) error {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	var req SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.SetRole(c.Request().Context(), actor(c), userID, req.Role); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) AdviceUsage(c echo.Context) error {
+	result, err := h.service.AdviceUsage(c.Request().Context(), actor(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result)
+}
+
+// ListAudit — GET /admin/audit?userId=&action=&cursor=&limit=
+func (h *Handler) ListAudit(c echo.Context) error {
+	limit, err := queryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	userID := 0
+	if raw := c.QueryParam("userId"); raw != "" {
+		userID, err = strconv.Atoi(raw)
+		if err != nil {
+			return apperrors.NewWithDetails(400, "Неверный параметр userId", err.Error())
+		}
+	}
+
+	result, err := h.service.ListAudit(c.Request().Context(), actor(c), userID, c.QueryParam("action"), c.QueryParam("cursor"), limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result)
+}
+
+// Metrics — GET /admin/metrics: счётчики expvar, просмотр записывается в журнал
+func (h *Handler) Metrics(c echo.Context) error {
+	if err := h.service.RecordMetricsView(c.Request().Context(), actor(c)); err != nil {
+		return err
+	}
+
+	expvar.Handler().ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+func actor(c echo.Context) Actor {
+	return Actor{
+		UserID: middleware.GetPrincipal(c).UserID,
+		IP:     c.RealIP(),
+	}
+}
+
+func queryLimit(c echo.Context) (int, error) {
+	raw := c.QueryParam("limit")
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, apperrors.NewWithDetails(400, "Неверный параметр limit", err.Error())
+	}
+	return limit, nil
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
+)
+
+// Actor — администратор, выполняющий действие
+type Actor struct {
+	UserID int
+	IP     string
+}
+
+type UserSummary struct {
+	ID            int        `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	Role          string     `json:"role"`
+	EmailVerified bool       `json:"emailVerified"`
+	MFAEnabled    bool       `json:"mfaEnabled"`
+	DisabledAt    *time.Time `json:"disabledAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+type UserListResponse struct {
+	Users      []UserSummary `json:"users"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// UserDetails — карточка пользователя для поддержки
+type UserDetails struct {
+	UserSummary
+	AdviceSessions int        `json:"adviceSessions"`
+	LastAdviceAt   *time.Time `json:"lastAdviceAt"`
+	ActiveAPIKeys  int        `json:"activeApiKeys"`
+	Identities     []string   `json:"identities"` // привязанные провайдеры входа
+}
+
+type DisableUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// AdviceUsage — агрегированная статистика консультаций
+type AdviceUsage struct {
+	TotalSessions  int          `json:"totalSessions"`
+	TotalQuestions int          `json:"totalQuestions"`
+	Sessions24h    int          `json:"sessions24h"`
+	Sessions7d     int          `json:"sessions7d"`
+	Sessions30d    int          `json:"sessions30d"`
+	ActiveUsers30d int          `json:"activeUsers30d"`
+	Daily          []DailyUsage `json:"daily"` // последние 30 дней
+}
+
+type DailyUsage struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Sessions  int    `json:"sessions"`
+	Questions int    `json:"questions"`
+}
+
+type AuditListResponse struct {
+	Entries    []audit.Entry `json:"entries"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
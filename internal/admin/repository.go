@@ -0,0 +1,220 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// WithTx выполняет fn в транзакции: изменения и запись аудита о них
+// фиксируются вместе или не фиксируются вовсе
+func (r *Repository) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+const userSummaryColumns = `id, email, COALESCE(name, ''), role, email_verified_at IS NOT NULL,
+	totp_enabled_at IS NOT NULL, disabled_at, created_at`
+
+func scanUserSummary(row interface{ Scan(...any) error }, user *UserSummary) error {
+	return row.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.EmailVerified,
+		&user.MFAEnabled, &user.DisabledAt, &user.CreatedAt)
+}
+
+// SearchUsers ищет пользователей по подстроке email или имени, новые первыми
+func (r *Repository) SearchUsers(ctx context.Context, query string, cursor, limit int) ([]UserSummary, error) {
+	pattern := ""
+	if query != "" {
+		pattern = "%" + escapeLike(query) + "%"
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+userSummaryColumns+`
+		 FROM users
+		 WHERE ($1 = '' OR email ILIKE $1 OR name ILIKE $1)
+		   AND ($2 = 0 OR id < $2)
+		 ORDER BY id DESC
+		 LIMIT $3`,
+		pattern, cursor, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err := scanUserSummary(rows, &user); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *Repository) GetUser(ctx context.Context, userID int) (*UserDetails, error) {
+	var details UserDetails
+	err := scanUserSummary(r.db.QueryRowContext(ctx,
+		`SELECT `+userSummaryColumns+` FROM users WHERE id = $1`, userID,
+	), &details.UserSummary)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT
+		   (SELECT COUNT(*) FROM advice_sessions WHERE user_id = $1),
+		   (SELECT MAX(created_at) FROM advice_sessions WHERE user_id = $1),
+		   (SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL
+		      AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)),
+		   ARRAY(SELECT provider FROM user_identities WHERE user_id = $1 ORDER BY provider)`,
+		userID,
+	).Scan(&details.AdviceSessions, &details.LastAdviceAt, &details.ActiveAPIKeys, pq.Array(&details.Identities))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user stats: %w", err)
+	}
+
+	return &details, nil
+}
+
+// SetDisabled блокирует или разблокирует аккаунт
+func (r *Repository) SetDisabled(ctx context.Context, tx *sql.Tx, userID int, disabled bool) error {
+	res, err := tx.ExecContext(ctx,
+		`UPDATE users
+		 SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+		     updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		userID, disabled,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	return requireAffected(res)
+}
+
+func (r *Repository) SetRole(ctx context.Context, tx *sql.Tx, userID int, role string) error {
+	res, err := tx.ExecContext(ctx,
+		`UPDATE users SET role = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		userID, role,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set role: %w", err)
+	}
+	return requireAffected(res)
+}
+
+// PromoteByEmail назначает роль пользователям из списка; возвращает id повышенных
+func (r *Repository) PromoteByEmail(ctx context.Context, tx *sql.Tx, emails []string, role string) ([]int, error) {
+	rows, err := tx.QueryContext(ctx,
+		`UPDATE users SET role = $2, updated_at = CURRENT_TIMESTAMP
+		 WHERE LOWER(email) = ANY($1) AND role <> $2
+		 RETURNING id`,
+		pq.Array(emails), role,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to promote users: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AdviceUsage считает статистику по сохранённым консультациям.
+// Анонимные консультации не сохраняются и в статистику не попадают
+func (r *Repository) AdviceUsage(ctx context.Context, days int) (*AdviceUsage, error) {
+	var usage AdviceUsage
+	err := r.db.QueryRowContext(ctx,
+		`SELECT
+		   (SELECT COUNT(*) FROM advice_sessions),
+		   (SELECT COUNT(*) FROM advice_messages WHERE role = 'user'),
+		   (SELECT COUNT(*) FROM advice_sessions WHERE created_at > NOW() - INTERVAL '1 day'),
+		   (SELECT COUNT(*) FROM advice_sessions WHERE created_at > NOW() - INTERVAL '7 days'),
+		   (SELECT COUNT(*) FROM advice_sessions WHERE created_at > NOW() - INTERVAL '30 days'),
+		   (SELECT COUNT(DISTINCT user_id) FROM advice_sessions WHERE created_at > NOW() - INTERVAL '30 days')`,
+	).Scan(&usage.TotalSessions, &usage.TotalQuestions, &usage.Sessions24h, &usage.Sessions7d,
+		&usage.Sessions30d, &usage.ActiveUsers30d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count advice usage: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT d::date,
+		        (SELECT COUNT(*) FROM advice_sessions s WHERE s.created_at::date = d::date),
+		        (SELECT COUNT(*) FROM advice_messages m WHERE m.role = 'user' AND m.created_at::date = d::date)
+		 FROM generate_series(CURRENT_DATE - ($1::int - 1), CURRENT_DATE, INTERVAL '1 day') AS d
+		 ORDER BY d`,
+		days,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily advice usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage.Daily = []DailyUsage{}
+	for rows.Next() {
+		var day DailyUsage
+		var date time.Time
+		if err := rows.Scan(&date, &day.Sessions, &day.Questions); err != nil {
+			return nil, fmt.Errorf("failed to scan daily usage: %w", err)
+		}
+		day.Date = date.Format("2006-01-02")
+		usage.Daily = append(usage.Daily, day)
+	}
+
+	return &usage, rows.Err()
+}
+
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,302 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// Действия администраторов в журнале аудита. Просмотр тоже записывается:
+// карточки пользователей содержат персональные данные
+const (
+	ActionUserDisable = "admin.user.disable"
+	ActionUserEnable  = "admin.user.enable"
+	ActionUserLogout  = "admin.user.logout"
+	ActionUserRole    = "admin.user.role"
+	ActionBootstrap   = "admin.bootstrap"
+	ActionUsersList   = "admin.users.list"
+	ActionUserView    = "admin.user.view"
+	ActionStatsView   = "admin.stats.view"
+	ActionAuditView   = "admin.audit.view"
+	ActionMetricsView = "admin.metrics.view"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	usageDays       = 30
+	maxReasonLen    = 500
+)
+
+var errSelfAction = apperrors.New(http.StatusBadRequest, "Нельзя выполнить это действие над своим аккаунтом")
+
+// TokenRevoker завершает входы пользователя; реализуется auth.Service
+type TokenRevoker interface {
+	LogoutEverywhere(ctx context.Context, userID int) error
+	RevokeAccessTokens(ctx context.Context, userID int) error
+}
+
+type Service struct {
+	repo   *Repository
+	audit  *audit.Repository
+	tokens TokenRevoker
+}
+
+func NewService(repo *Repository, audit *audit.Repository, tokens TokenRevoker) *Service {
+	return &Service{
+		repo:   repo,
+		audit:  audit,
+		tokens: tokens,
+	}
+}
+
+// ListUsers ищет пользователей по email или имени с курсорной пагинацией
+func (s *Service) ListUsers(ctx context.Context, actor Actor, query, cursor string, limit int) (*UserListResponse, error) {
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit = pageSize(limit)
+	query = strings.TrimSpace(query)
+
+	users, err := s.repo.SearchUsers(ctx, query, after, limit+1)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка поиска пользователей")
+	}
+	if err := s.record(ctx, actor, ActionUsersList, 0, map[string]any{"query": query, "cursor": cursor}); err != nil {
+		return nil, err
+	}
+
+	resp := &UserListResponse{Users: users}
+	if len(users) > limit {
+		resp.Users = users[:limit]
+		resp.NextCursor = strconv.Itoa(users[limit-1].ID)
+	}
+	return resp, nil
+}
+
+func (s *Service) GetUser(ctx context.Context, actor Actor, userID int) (*UserDetails, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, userError(err, "Ошибка загрузки пользователя")
+	}
+	if err := s.record(ctx, actor, ActionUserView, userID, nil); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DisableUser блокирует аккаунт и сразу завершает все его входы
+func (s *Service) DisableUser(ctx context.Context, actor Actor, userID int, reason string) error {
+	if actor.UserID == userID {
+		return errSelfAction
+	}
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > maxReasonLen {
+		return apperrors.NewWithDetails(http.StatusBadRequest, "Неверный запрос", "Причина не длиннее 500 символов")
+	}
+
+	err := s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := s.repo.SetDisabled(ctx, tx, userID, true); err != nil {
+			return userError(err, "Ошибка блокировки пользователя")
+		}
+		return s.recordTx(ctx, tx, actor, ActionUserDisable, userID, map[string]any{"reason": reason})
+	})
+	if err != nil {
+		return txError(err, "Ошибка блокировки пользователя")
+	}
+
+	// Заблокированный не войдёт заново, поэтому повтор запроса доведёт отзыв до конца
+	return s.tokens.LogoutEverywhere(ctx, userID)
+}
+
+func (s *Service) EnableUser(ctx context.Context, actor Actor, userID int) error {
+	err := s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := s.repo.SetDisabled(ctx, tx, userID, false); err != nil {
+			return userError(err, "Ошибка разблокировки пользователя")
+		}
+		return s.recordTx(ctx, tx, actor, ActionUserEnable, userID, nil)
+	})
+	return txError(err, "Ошибка разблокировки пользователя")
+}
+
+// ForceLogout завершает все входы пользователя
+func (s *Service) ForceLogout(ctx context.Context, actor Actor, userID int) error {
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return userError(err, "Ошибка загрузки пользователя")
+	}
+	// Запись аудита фиксируется, только если отзыв удался
+	err := s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := s.recordTx(ctx, tx, actor, ActionUserLogout, userID, nil); err != nil {
+			return err
+		}
+		return s.tokens.LogoutEverywhere(ctx, userID)
+	})
+	return txError(err, "Ошибка завершения сессий")
+}
+
+// SetRole меняет роль. Токены доступа пользователя отзываются, чтобы новая роль
+// применилась сразу, а не после истечения токена
+func (s *Service) SetRole(ctx context.Context, actor Actor, userID int, role string) error {
+	if actor.UserID == userID {
+		return errSelfAction
+	}
+	if !middleware.ValidRole(role) {
+		return apperrors.NewWithDetails(http.StatusBadRequest, "Неизвестная роль", role)
+	}
+
+	err := s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := s.repo.SetRole(ctx, tx, userID, role); err != nil {
+			return userError(err, "Ошибка смены роли")
+		}
+		return s.recordTx(ctx, tx, actor, ActionUserRole, userID, map[string]any{"role": role})
+	})
+	if err != nil {
+		return txError(err, "Ошибка смены роли")
+	}
+
+	return s.tokens.RevokeAccessTokens(ctx, userID)
+}
+
+func (s *Service) AdviceUsage(ctx context.Context, actor Actor) (*AdviceUsage, error) {
+	usage, err := s.repo.AdviceUsage(ctx, usageDays)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки статистики")
+	}
+	if err := s.record(ctx, actor, ActionStatsView, 0, nil); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// RecordMetricsView записывает просмотр /admin/metrics до того, как они будут отданы
+func (s *Service) RecordMetricsView(ctx context.Context, actor Actor) error {
+	return s.record(ctx, actor, ActionMetricsView, 0, nil)
+}
+
+// ListAudit возвращает журнал аудита, при необходимости по одному пользователю
+func (s *Service) ListAudit(ctx context.Context, actor Actor, targetUserID int, action, cursor string, limit int) (*AuditListResponse, error) {
+	after, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	limit = pageSize(limit)
+
+	entries, err := s.audit.List(ctx, audit.Filter{TargetUserID: targetUserID, Action: action, Cursor: after, Limit: limit + 1})
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки журнала")
+	}
+	if err := s.record(ctx, actor, ActionAuditView, targetUserID, map[string]any{"action": action, "cursor": cursor}); err != nil {
+		return nil, err
+	}
+
+	resp := &AuditListResponse{Entries: entries}
+	if len(entries) > limit {
+		resp.Entries = entries[:limit]
+		resp.NextCursor = strconv.Itoa(entries[limit-1].ID)
+	}
+	return resp, nil
+}
+
+// BootstrapAdmins назначает роль admin адресам из конфигурации (ADMIN_EMAILS)
+func (s *Service) BootstrapAdmins(ctx context.Context, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			normalized = append(normalized, email)
+		}
+	}
+
+	return s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		ids, err := s.repo.PromoteByEmail(ctx, tx, normalized, middleware.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			log.Printf("User %d promoted to admin from ADMIN_EMAILS", id)
+			if err := s.recordTx(ctx, tx, Actor{}, ActionBootstrap, id, map[string]any{"role": middleware.RoleAdmin}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// record пишет в журнал просмотр; без записи данные не отдаются
+func (s *Service) record(ctx context.Context, actor Actor, action string, targetUserID int, details map[string]any) error {
+	if err := s.audit.Record(ctx, auditEntry(actor, action, targetUserID, details)); err != nil {
+		return apperrors.Wrap(err, "Ошибка записи в журнал аудита")
+	}
+	return nil
+}
+
+// recordTx пишет в журнал изменение в его же транзакции
+func (s *Service) recordTx(ctx context.Context, tx *sql.Tx, actor Actor, action string, targetUserID int, details map[string]any) error {
+	if err := s.audit.RecordTx(ctx, tx, auditEntry(actor, action, targetUserID, details)); err != nil {
+		return apperrors.Wrap(err, "Ошибка записи в журнал аудита")
+	}
+	return nil
+}
+
+func auditEntry(actor Actor, action string, targetUserID int, details map[string]any) audit.Entry {
+	return audit.Entry{
+		ActorID:      actor.UserID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		IP:           actor.IP,
+		Details:      details,
+	}
+}
+
+func parseCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	after, err := strconv.Atoi(cursor)
+	if err != nil || after <= 0 {
+		return 0, apperrors.NewWithDetails(400, "Неверный курсор", "cursor must be a value from nextCursor")
+	}
+	return after, nil
+}
+
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// txError оставляет ошибки приложения из транзакции как есть, остальные (начало
+// и фиксация транзакции) оборачивает в message
+func txError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	var appErr *apperrors.AppError
+	if errors.As(err, &appErr) {
+		return err
+	}
+	return apperrors.Wrap(err, message)
+}
+
+func userError(err error, message string) error {
+	if errors.Is(err, ErrUserNotFound) {
+		return apperrors.ErrNotFound
+	}
+	return apperrors.Wrap(err, message)
+}
@@ -0,0 +1,290 @@
+package advice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Kir-Khorev/finopp-back/internal/budget"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// analysisSchema — JSON Schema отчёта /analyze. Суммы считает calculateBudget,
+// от модели нужны только оценка риска и текст. Ответ проверяется validateAnalysisReport
+const analysisSchema = `{
+  "type": "object",
+  "required": ["riskLevel", "summary", "recommendations"],
+  "properties": {
+    "riskLevel": {"enum": ["low", "medium", "high"]},
+    "summary": {"type": "string", "minLength": 1},
+    "recommendations": {"type": "array", "minItems": 1, "maxItems": 7, "items": {"type": "string", "minLength": 1}}
+  }
+}`
+
+// Уровни финансового риска в отчёте анализа
+const (
+	riskLow    = "low"
+	riskMedium = "medium"
+	riskHigh   = "high"
+)
+
+const maxRecommendations = 7
+
+var errAnalysisFormat = apperrors.New(http.StatusServiceUnavailable, "Модель вернула анализ в неверном формате, попробуйте ещё раз")
+
+// analysisReport — ответ модели по analysisSchema
+type analysisReport struct {
+	RiskLevel       string   `json:"riskLevel"`
+	Summary         string   `json:"summary"`
+	Recommendations []string `json:"recommendations"`
+}
+
+// budgetSummary — доходы и расходы в рублях в месяц, посчитанные кодом, а не моделью
+type budgetSummary struct {
+	IncomeItems      []AnalysisItem
+	ExpenseItems     []AnalysisItem
+	TotalIncomeRUB   float64
+	TotalExpensesRUB float64
+	BalanceRUB       float64
+}
+
+// recognized: нашлась ли в тексте хотя бы одна сумма
+func (b *budgetSummary) recognized() bool {
+	return len(b.IncomeItems) > 0 || len(b.ExpenseItems) > 0
+}
+
+// calculateBudget разбирает суммы из текста пользователя, приводит их к рублям
+// в месяц и считает итоги
+func (s *Service) calculateBudget(ctx context.Context, req AnalysisRequest) (*budgetSummary, error) {
+	var b budgetSummary
+	var err error
+	if b.IncomeItems, b.TotalIncomeRUB, err = s.budgetItems(ctx, req.Income, "Доход"); err != nil {
+		return nil, err
+	}
+	if b.ExpenseItems, b.TotalExpensesRUB, err = s.budgetItems(ctx, req.Expenses, "Расход"); err != nil {
+		return nil, err
+	}
+	b.BalanceRUB = roundKopecks(b.TotalIncomeRUB - b.TotalExpensesRUB)
+	return &b, nil
+}
+
+// budgetItems превращает суммы из текста в статьи; без подписи статья называется defaultLabel
+func (s *Service) budgetItems(ctx context.Context, text, defaultLabel string) ([]AnalysisItem, float64, error) {
+	items := []AnalysisItem{}
+	total := 0.0
+	for _, amount := range budget.Parse(text) {
+		monthly := amount.Monthly()
+		if amount.Currency != "RUB" {
+			converted, err := s.currencyConverter.ConvertToRUB(ctx, monthly, amount.Currency)
+			if err != nil {
+				return nil, 0, conversionError(err)
+			}
+			monthly = roundKopecks(converted)
+		}
+
+		label := amount.Label
+		if label == "" {
+			label = defaultLabel
+		}
+		items = append(items, AnalysisItem{Name: label, AmountRUB: monthly, Source: amount.Source})
+		total += monthly
+	}
+	return items, roundKopecks(total), nil
+}
+
+// describeBudget — проверенные расчёты для промпта
+func describeBudget(b *budgetSummary) string {
+	if !b.recognized() {
+		return "Суммы в тексте не распознаны. Не придумывай цифры: дай совет по описанию ситуации."
+	}
+
+	var sb strings.Builder
+	writeItems := func(title string, items []AnalysisItem, total float64) {
+		sb.WriteString(title + ":\n")
+		if len(items) == 0 {
+			sb.WriteString("- суммы не указаны\n")
+		}
+		for _, item := range items {
+			fmt.Fprintf(&sb, "- %s: %.0f руб/мес\n", item.Name, item.AmountRUB)
+		}
+		fmt.Fprintf(&sb, "Итого: %.0f руб/мес\n\n", total)
+	}
+	writeItems("Доходы", b.IncomeItems, b.TotalIncomeRUB)
+	writeItems("Расходы", b.ExpenseItems, b.TotalExpensesRUB)
+
+	label := "Профицит"
+	if b.BalanceRUB < 0 {
+		label = "Дефицит"
+	}
+	fmt.Fprintf(&sb, "%s: %.0f руб/мес", label, math.Abs(b.BalanceRUB))
+	return sb.String()
+}
+
+// analysisJSONInstruction открывает в промпте анализа требования к формату ответа
+const analysisJSONInstruction = "Верни ТОЛЬКО JSON-объект"
+
+// analysisQuestion — первое сообщение сессии анализа: что ввёл пользователь
+// и проверенные расчёты, без инструкций о формате ответа
+func analysisQuestion(req AnalysisRequest, b *budgetSummary) string {
+	var sb strings.Builder
+	sb.WriteString("Проанализируй мою финансовую ситуацию.\n\n")
+	fmt.Fprintf(&sb, "Статус: %s\nЕжемесячные расходы: %s\nЕжемесячные доходы: %s\n", req.Status, req.Expenses, req.Income)
+	if req.Additional != nil && *req.Additional != "" {
+		fmt.Fprintf(&sb, "Дополнительная информация: %s\n", *req.Additional)
+	}
+	sb.WriteString("\nПроверенные расчёты (все суммы в рублях в месяц):\n")
+	sb.WriteString(describeBudget(b))
+	return sb.String()
+}
+
+// stripAnalysisInstructions убирает требования к JSON из первого сообщения
+// сессий анализа, сохранённых до analysisQuestion
+func stripAnalysisInstructions(content string) string {
+	if before, _, found := strings.Cut(content, analysisJSONInstruction); found {
+		return strings.TrimSpace(before)
+	}
+	return content
+}
+
+// completeAnalysis запрашивает отчёт в JSON mode. Если ответ не прошёл проверку,
+// один раз просит модель исправить его, перечислив найденные нарушения
+func (s *Service) completeAnalysis(ctx context.Context, prompt string) (*analysisReport, error) {
+	messages := []Message{{Role: roleUser, Content: prompt}}
+
+	resp, err := s.llm.Complete(ctx, ChatRequest{Messages: messages, JSONMode: true})
+	if err != nil {
+		return nil, err
+	}
+
+	report, problems := parseAnalysisReport(resp.Content)
+	if len(problems) == 0 {
+		return report, nil
+	}
+	log.Printf("Analysis report failed validation, asking model to repair: %s", strings.Join(problems, "; "))
+
+	messages = append(messages,
+		Message{Role: roleAssistant, Content: resp.Content},
+		Message{Role: roleUser, Content: repairPrompt(problems)},
+	)
+	resp, err = s.llm.Complete(ctx, ChatRequest{Messages: messages, JSONMode: true})
+	if err != nil {
+		return nil, err
+	}
+
+	report, problems = parseAnalysisReport(resp.Content)
+	if len(problems) > 0 {
+		log.Printf("Analysis report still invalid after repair: %s", strings.Join(problems, "; "))
+		return nil, errAnalysisFormat
+	}
+	return report, nil
+}
+
+// repairPrompt объясняет модели, что исправить в предыдущем ответе
+func repairPrompt(problems []string) string {
+	return "Твой ответ не соответствует JSON Schema:\n- " + strings.Join(problems, "\n- ") +
+		"\n\nВерни исправленный JSON-объект целиком, без пояснений и markdown."
+}
+
+// parseAnalysisReport разбирает ответ модели и возвращает нарушения схемы.
+// Модели иногда оборачивают JSON в ```json — такую обёртку снимаем
+func parseAnalysisReport(text string) (*analysisReport, []string) {
+	text = strings.TrimSpace(text)
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, []string{"ответ не содержит JSON-объекта"}
+	}
+	raw := []byte(text[start : end+1])
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, []string{"некорректный JSON: " + err.Error()}
+	}
+
+	var problems []string
+	for _, key := range []string{"riskLevel", "summary", "recommendations"} {
+		if _, ok := fields[key]; !ok {
+			problems = append(problems, "нет обязательного поля "+key)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	var report analysisReport
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return nil, []string{"неверный тип поля: " + err.Error()}
+	}
+
+	if problems := validateAnalysisReport(&report); len(problems) > 0 {
+		return nil, problems
+	}
+	return &report, nil
+}
+
+// validateAnalysisReport проверяет ограничения схемы
+func validateAnalysisReport(r *analysisReport) []string {
+	var problems []string
+
+	switch r.RiskLevel {
+	case riskLow, riskMedium, riskHigh:
+	default:
+		problems = append(problems, fmt.Sprintf("riskLevel %q: допустимы low, medium, high", r.RiskLevel))
+	}
+
+	if strings.TrimSpace(r.Summary) == "" {
+		problems = append(problems, "summary пустое")
+	}
+
+	if len(r.Recommendations) == 0 || len(r.Recommendations) > maxRecommendations {
+		problems = append(problems, fmt.Sprintf("recommendations: нужно от 1 до %d пунктов", maxRecommendations))
+	}
+	for i, rec := range r.Recommendations {
+		if strings.TrimSpace(rec) == "" {
+			problems = append(problems, fmt.Sprintf("recommendations[%d] пустое", i))
+		}
+	}
+
+	return problems
+}
+
+func roundKopecks(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// analysisResponse соединяет посчитанный бюджет с текстом модели
+// и добавляет их текстовый вид для старых клиентов
+func analysisResponse(b *budgetSummary, r *analysisReport) AnalysisResponse {
+	var advice strings.Builder
+	advice.WriteString(strings.TrimSpace(r.Summary))
+	advice.WriteString("\n")
+	for i, rec := range r.Recommendations {
+		fmt.Fprintf(&advice, "\n%d. %s", i+1, strings.TrimSpace(rec))
+	}
+
+	balance := "Данные недоступны"
+	if b.recognized() {
+		balanceLabel := "Профицит"
+		if b.BalanceRUB < 0 {
+			balanceLabel = "Дефицит"
+		}
+		balance = fmt.Sprintf("Доход: %.0f руб/мес\nРасход: %.0f руб/мес\n%s: %.0f руб/мес",
+			b.TotalIncomeRUB, b.TotalExpensesRUB, balanceLabel, math.Abs(b.BalanceRUB))
+	}
+
+	return AnalysisResponse{
+		Balance:          balance,
+		Advice:           advice.String(),
+		IncomeItems:      b.IncomeItems,
+		ExpenseItems:     b.ExpenseItems,
+		TotalIncomeRUB:   b.TotalIncomeRUB,
+		TotalExpensesRUB: b.TotalExpensesRUB,
+		BalanceRUB:       b.BalanceRUB,
+		RiskLevel:        r.RiskLevel,
+		Summary:          r.Summary,
+		Recommendations:  r.Recommendations,
+	}
+}
@@ -0,0 +1,325 @@
+package advice
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Финансовые калькуляторы для инструментов модели. Суммы в рублях, ставки — годовые в процентах
+
+const (
+	// maxCalcMonths — горизонт расчётов: 50 лет
+	maxCalcMonths = 600
+	// ndflRate и ndflHighRate — НДФЛ с процентов по вкладам до и сверх ndflHighThreshold в год
+	ndflRate          = 0.13
+	ndflHighRate      = 0.15
+	ndflHighThreshold = 2_400_000
+	// taxFreeDepositBase × максимальная ключевая ставка года — необлагаемый процентный доход
+	taxFreeDepositBase = 1_000_000
+)
+
+// loanYear — итоги года по кредиту
+type loanYear struct {
+	Year          int     `json:"year"`
+	PrincipalPaid float64 `json:"principalPaid"`
+	InterestPaid  float64 `json:"interestPaid"`
+	Balance       float64 `json:"balance"` // остаток долга на конец года
+}
+
+type loanSchedule struct {
+	MonthlyPayment float64    `json:"monthlyPayment"`
+	TotalPayment   float64    `json:"totalPayment"`
+	Overpayment    float64    `json:"overpayment"`
+	Years          []loanYear `json:"years"`
+}
+
+// loanAmortization считает аннуитетный кредит: равные платежи, проценты на остаток
+func loanAmortization(principal, annualRate float64, months int) (*loanSchedule, error) {
+	if principal <= 0 {
+		return nil, errors.New("principal must be positive")
+	}
+	if annualRate < 0 || annualRate > 100 {
+		return nil, errors.New("annualRatePercent must be between 0 and 100")
+	}
+	if months < 1 || months > maxCalcMonths {
+		return nil, errors.New("months must be between 1 and 600")
+	}
+
+	r := annualRate / 100 / 12
+	payment := principal / float64(months)
+	if r > 0 {
+		payment = principal * r / (1 - math.Pow(1+r, -float64(months)))
+	}
+
+	schedule := &loanSchedule{MonthlyPayment: roundKopecks(payment)}
+	balance := principal
+	var year loanYear
+	for month := 1; month <= months; month++ {
+		interest := balance * r
+		principalPart := payment - interest
+		if month == months {
+			principalPart = balance
+		}
+		balance -= principalPart
+		schedule.TotalPayment += principalPart + interest
+
+		year.PrincipalPaid += principalPart
+		year.InterestPaid += interest
+		if month%12 == 0 || month == months {
+			year.Year = (month + 11) / 12
+			year.Balance = math.Max(balance, 0)
+			schedule.Years = append(schedule.Years, roundLoanYear(year))
+			year = loanYear{}
+		}
+	}
+
+	schedule.TotalPayment = roundKopecks(schedule.TotalPayment)
+	schedule.Overpayment = roundKopecks(schedule.TotalPayment - principal)
+	return schedule, nil
+}
+
+func roundLoanYear(y loanYear) loanYear {
+	y.PrincipalPaid = roundKopecks(y.PrincipalPaid)
+	y.InterestPaid = roundKopecks(y.InterestPaid)
+	y.Balance = roundKopecks(y.Balance)
+	return y
+}
+
+// savingsYear — сумма на счёте на конец года
+type savingsYear struct {
+	Year    int     `json:"year"`
+	Balance float64 `json:"balance"`
+}
+
+type savingsProjection struct {
+	FinalAmount      float64       `json:"finalAmount"`
+	TotalContributed float64       `json:"totalContributed"`
+	InterestEarned   float64       `json:"interestEarned"`
+	Years            []savingsYear `json:"years"`
+}
+
+// Периодичность капитализации процентов, в месяцах
+var capitalizationMonths = map[string]int{"monthly": 1, "quarterly": 3, "yearly": 12}
+
+// compoundInterest считает накопления с ежемесячными пополнениями в конце месяца.
+// Проценты начисляются ежемесячно, а на остаток добавляются раз в период капитализации
+func compoundInterest(initial, monthlyContribution, annualRate float64, years int, capitalization string) (*savingsProjection, error) {
+	if initial < 0 || monthlyContribution < 0 {
+		return nil, errors.New("amounts must not be negative")
+	}
+	if annualRate < 0 || annualRate > 100 {
+		return nil, errors.New("annualRatePercent must be between 0 and 100")
+	}
+	if years < 1 || years*12 > maxCalcMonths {
+		return nil, errors.New("years must be between 1 and 50")
+	}
+	if capitalization == "" {
+		capitalization = "monthly"
+	}
+	period, ok := capitalizationMonths[capitalization]
+	if !ok {
+		return nil, errors.New("capitalization must be monthly, quarterly or yearly")
+	}
+
+	r := annualRate / 100 / 12
+	balance, accrued := initial, 0.0
+	projection := &savingsProjection{TotalContributed: initial}
+	for month := 1; month <= years*12; month++ {
+		accrued += balance * r
+		if month%period == 0 {
+			balance += accrued
+			accrued = 0
+		}
+		balance += monthlyContribution
+		projection.TotalContributed += monthlyContribution
+
+		if month%12 == 0 {
+			projection.Years = append(projection.Years, savingsYear{Year: month / 12, Balance: roundKopecks(balance)})
+		}
+	}
+
+	projection.FinalAmount = roundKopecks(balance + accrued)
+	projection.TotalContributed = roundKopecks(projection.TotalContributed)
+	projection.InterestEarned = roundKopecks(projection.FinalAmount - projection.TotalContributed)
+	return projection, nil
+}
+
+type depositYield struct {
+	GrossInterest float64 `json:"grossInterest"`
+	TaxFreeLimit  float64 `json:"taxFreeLimitPerYear"`
+	Tax           float64 `json:"tax"`
+	NetInterest   float64 `json:"netInterest"`
+	FinalAmount   float64 `json:"finalAmount"`
+	// EffectiveRate — годовая доходность после налога, %
+	EffectiveRate float64 `json:"effectiveRatePercent"`
+	Assumption    string  `json:"assumption"`
+}
+
+// depositAfterTax считает доход по вкладу и НДФЛ с процентов. Необлагаемый лимит —
+// 1 млн ₽ × максимальная ключевая ставка за год; каждые 12 месяцев вклада считаются
+// отдельным налоговым годом
+func depositAfterTax(amount, annualRate float64, months int, capitalization bool, keyRate float64) (*depositYield, error) {
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if annualRate < 0 || annualRate > 100 || keyRate < 0 || keyRate > 100 {
+		return nil, errors.New("rates must be between 0 and 100")
+	}
+	if months < 1 || months > maxCalcMonths {
+		return nil, errors.New("months must be between 1 and 600")
+	}
+
+	r := annualRate / 100 / 12
+	limit := taxFreeDepositBase * keyRate / 100
+
+	balance, gross, tax := amount, 0.0, 0.0
+	yearInterest := 0.0
+	for month := 1; month <= months; month++ {
+		interest := amount * r
+		if capitalization {
+			interest = balance * r
+			balance += interest
+		}
+		gross += interest
+		yearInterest += interest
+
+		if month%12 == 0 || month == months {
+			tax += ndflOnInterest(yearInterest - limit)
+			yearInterest = 0
+		}
+	}
+
+	result := &depositYield{
+		GrossInterest: roundKopecks(gross),
+		TaxFreeLimit:  roundKopecks(limit),
+		Tax:           roundKopecks(tax),
+		NetInterest:   roundKopecks(gross - tax),
+		FinalAmount:   roundKopecks(amount + gross - tax),
+		Assumption:    "других вкладов и процентов по счетам у вкладчика нет",
+	}
+	result.EffectiveRate = roundKopecks((gross - tax) / amount / float64(months) * 12 * 100)
+	return result, nil
+}
+
+// ndflOnInterest — налог с облагаемой части процентов за год
+func ndflOnInterest(taxable float64) float64 {
+	if taxable <= 0 {
+		return 0
+	}
+	if taxable <= ndflHighThreshold {
+		return taxable * ndflRate
+	}
+	return ndflHighThreshold*ndflRate + (taxable-ndflHighThreshold)*ndflHighRate
+}
+
+// debtItem — долг для расчёта погашения
+type debtItem struct {
+	Name       string  `json:"name"`
+	Balance    float64 `json:"balance"`
+	AnnualRate float64 `json:"annualRatePercent"`
+	MinPayment float64 `json:"minPayment"`
+}
+
+type debtPaidOff struct {
+	Name  string `json:"name"`
+	Month int    `json:"month"`
+}
+
+type debtPayoffPlan struct {
+	Months        int           `json:"months"`
+	TotalInterest float64       `json:"totalInterest"`
+	TotalPaid     float64       `json:"totalPaid"`
+	PayoffOrder   []debtPaidOff `json:"payoffOrder"`
+}
+
+// Стратегии досрочного погашения
+const (
+	strategyAvalanche = "avalanche" // сначала самый дорогой долг
+	strategySnowball  = "snowball"  // сначала самый маленький долг
+)
+
+// debtPayoff моделирует погашение: по всем долгам вносится минимальный платёж,
+// остаток бюджета идёт на приоритетный долг по стратегии
+func debtPayoff(debts []debtItem, monthlyBudget float64, strategy string) (*debtPayoffPlan, error) {
+	if len(debts) == 0 || len(debts) > 20 {
+		return nil, errors.New("debts must contain 1 to 20 items")
+	}
+	if strategy == "" {
+		strategy = strategyAvalanche
+	}
+	if strategy != strategyAvalanche && strategy != strategySnowball {
+		return nil, errors.New("strategy must be avalanche or snowball")
+	}
+
+	balances := make([]float64, len(debts))
+	minTotal := 0.0
+	for i, d := range debts {
+		if d.Balance < 0 || d.MinPayment < 0 || d.AnnualRate < 0 || d.AnnualRate > 100 {
+			return nil, errors.New("debt balance, rate and minPayment must not be negative, rate at most 100")
+		}
+		balances[i] = d.Balance
+		minTotal += d.MinPayment
+	}
+	if monthlyBudget < minTotal {
+		return nil, errors.New("monthlyBudget is less than the sum of minimum payments")
+	}
+
+	order := make([]int, len(debts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		da, db := debts[order[a]], debts[order[b]]
+		if strategy == strategySnowball {
+			return da.Balance < db.Balance
+		}
+		return da.AnnualRate > db.AnnualRate
+	})
+
+	plan := &debtPayoffPlan{}
+	closed := make([]bool, len(debts))
+	for month := 1; month <= maxCalcMonths; month++ {
+		remaining := monthlyBudget
+		for i, d := range debts {
+			if balances[i] <= 0 {
+				continue
+			}
+			interest := balances[i] * d.AnnualRate / 100 / 12
+			balances[i] += interest
+			plan.TotalInterest += interest
+
+			pay := math.Min(d.MinPayment, balances[i])
+			balances[i] -= pay
+			remaining -= pay
+		}
+		for _, i := range order {
+			if remaining <= 0 {
+				break
+			}
+			pay := math.Min(remaining, balances[i])
+			balances[i] -= pay
+			remaining -= pay
+		}
+		plan.TotalPaid += monthlyBudget - remaining
+
+		open := 0
+		for _, i := range order {
+			if balances[i] > 0.005 {
+				open++
+				continue
+			}
+			if !closed[i] {
+				closed[i], balances[i] = true, 0
+				plan.PayoffOrder = append(plan.PayoffOrder, debtPaidOff{Name: debts[i].Name, Month: month})
+			}
+		}
+		if open == 0 {
+			plan.Months = month
+			plan.TotalInterest = roundKopecks(plan.TotalInterest)
+			plan.TotalPaid = roundKopecks(plan.TotalPaid)
+			return plan, nil
+		}
+	}
+	return nil, errors.New("debts are not paid off within 50 years with this budget")
+}
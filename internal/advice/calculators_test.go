@@ -0,0 +1,234 @@
+package advice
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoanAmortization(t *testing.T) {
+	tests := []struct {
+		name        string
+		principal   float64
+		rate        float64
+		months      int
+		payment     float64
+		total       float64
+		overpayment float64
+		years       []loanYear
+	}{
+		{"аннуитет 1 млн под 12% на год", 1_000_000, 12, 12, 88_848.79, 1_066_185.46, 66_185.46,
+			[]loanYear{{Year: 1, PrincipalPaid: 1_000_000, InterestPaid: 66_185.46, Balance: 0}}},
+		{"без процентов", 120_000, 0, 24, 5_000, 120_000, 0,
+			[]loanYear{{Year: 1, PrincipalPaid: 60_000, Balance: 60_000}, {Year: 2, PrincipalPaid: 60_000, Balance: 0}}},
+		{"неполный последний год", 150_000, 0, 15, 10_000, 150_000, 0,
+			[]loanYear{{Year: 1, PrincipalPaid: 120_000, Balance: 30_000}, {Year: 2, PrincipalPaid: 30_000, Balance: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loanAmortization(tt.principal, tt.rate, tt.months)
+			if err != nil {
+				t.Fatalf("loanAmortization: %v", err)
+			}
+			if got.MonthlyPayment != tt.payment || got.TotalPayment != tt.total || got.Overpayment != tt.overpayment {
+				t.Errorf("payment, total, overpayment = %v, %v, %v, want %v, %v, %v",
+					got.MonthlyPayment, got.TotalPayment, got.Overpayment, tt.payment, tt.total, tt.overpayment)
+			}
+			if !reflect.DeepEqual(got.Years, tt.years) {
+				t.Errorf("years = %+v, want %+v", got.Years, tt.years)
+			}
+		})
+	}
+}
+
+func TestLoanAmortizationValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal float64
+		rate      float64
+		months    int
+	}{
+		{"нулевая сумма", 0, 12, 12},
+		{"отрицательная ставка", 100_000, -1, 12},
+		{"ставка больше 100%", 100_000, 101, 12},
+		{"ноль месяцев", 100_000, 12, 0},
+		{"дольше 50 лет", 100_000, 12, maxCalcMonths + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loanAmortization(tt.principal, tt.rate, tt.months); err == nil {
+				t.Fatal("loanAmortization: want error")
+			}
+		})
+	}
+}
+
+func TestCompoundInterest(t *testing.T) {
+	tests := []struct {
+		name           string
+		initial        float64
+		contribution   float64
+		rate           float64
+		years          int
+		capitalization string
+		final          float64
+		contributed    float64
+	}{
+		{"ежемесячная капитализация", 100_000, 0, 12, 1, "monthly", 112_682.50, 100_000},
+		{"капитализация по умолчанию ежемесячная", 100_000, 0, 12, 1, "", 112_682.50, 100_000},
+		{"ежеквартальная капитализация", 100_000, 0, 12, 1, "quarterly", 112_550.88, 100_000},
+		{"ежегодная капитализация", 100_000, 0, 12, 1, "yearly", 112_000, 100_000},
+		{"пополнения в конце месяца", 0, 10_000, 12, 1, "monthly", 126_825.03, 120_000},
+		{"без процентов", 50_000, 10_000, 0, 2, "monthly", 290_000, 290_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compoundInterest(tt.initial, tt.contribution, tt.rate, tt.years, tt.capitalization)
+			if err != nil {
+				t.Fatalf("compoundInterest: %v", err)
+			}
+			if got.FinalAmount != tt.final || got.TotalContributed != tt.contributed {
+				t.Errorf("final, contributed = %v, %v, want %v, %v", got.FinalAmount, got.TotalContributed, tt.final, tt.contributed)
+			}
+			if want := roundKopecks(tt.final - tt.contributed); got.InterestEarned != want {
+				t.Errorf("interest = %v, want %v", got.InterestEarned, want)
+			}
+			if len(got.Years) != tt.years {
+				t.Errorf("got %d years, want %d", len(got.Years), tt.years)
+			}
+		})
+	}
+
+	if _, err := compoundInterest(100_000, 0, 12, 1, "daily"); err == nil {
+		t.Error("compoundInterest with daily capitalization: want error")
+	}
+}
+
+func TestDepositAfterTax(t *testing.T) {
+	// Ключевая ставка 21%: необлагаемый лимит — 210 000 ₽ процентов в год
+	tests := []struct {
+		name           string
+		amount         float64
+		rate           float64
+		months         int
+		capitalization bool
+		gross          float64
+		tax            float64
+		effectiveRate  float64
+	}{
+		{"проценты ниже лимита", 1_000_000, 10, 12, false, 100_000, 0, 10},
+		{"капитализация ниже лимита", 1_000_000, 12, 12, true, 126_825.03, 0, 12.68},
+		// (1 000 000 − 210 000) × 13%
+		{"сверх лимита по 13%", 5_000_000, 20, 12, false, 1_000_000, 102_700, 17.95},
+		// 2 400 000 × 13% + (3 790 000 − 2 400 000) × 15%
+		{"сверх 2,4 млн по 15%", 20_000_000, 20, 12, false, 4_000_000, 520_500, 17.4},
+		// Лимит применяется к каждому году отдельно
+		{"два налоговых года", 5_000_000, 20, 24, false, 2_000_000, 205_400, 17.95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := depositAfterTax(tt.amount, tt.rate, tt.months, tt.capitalization, 21)
+			if err != nil {
+				t.Fatalf("depositAfterTax: %v", err)
+			}
+			if got.TaxFreeLimit != 210_000 {
+				t.Errorf("tax-free limit = %v, want 210000", got.TaxFreeLimit)
+			}
+			if got.GrossInterest != tt.gross || got.Tax != tt.tax {
+				t.Errorf("gross, tax = %v, %v, want %v, %v", got.GrossInterest, got.Tax, tt.gross, tt.tax)
+			}
+			if want := roundKopecks(tt.gross - tt.tax); got.NetInterest != want {
+				t.Errorf("net interest = %v, want %v", got.NetInterest, want)
+			}
+			if want := roundKopecks(tt.amount + tt.gross - tt.tax); got.FinalAmount != want {
+				t.Errorf("final amount = %v, want %v", got.FinalAmount, want)
+			}
+			if got.EffectiveRate != tt.effectiveRate {
+				t.Errorf("effective rate = %v, want %v", got.EffectiveRate, tt.effectiveRate)
+			}
+		})
+	}
+}
+
+func TestDebtPayoff(t *testing.T) {
+	// Кредитка дороже, но займ меньше: стратегии гасят их в разном порядке
+	debts := []debtItem{
+		{Name: "кредитка", Balance: 50_000, AnnualRate: 30, MinPayment: 2_000},
+		{Name: "займ", Balance: 20_000, AnnualRate: 10, MinPayment: 1_000},
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		want     []string
+	}{
+		{"лавина", strategyAvalanche, []string{"кредитка", "займ"}},
+		{"по умолчанию лавина", "", []string{"кредитка", "займ"}},
+		{"снежный ком", strategySnowball, []string{"займ", "кредитка"}},
+	}
+	plans := map[string]*debtPayoffPlan{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := debtPayoff(debts, 10_000, tt.strategy)
+			if err != nil {
+				t.Fatalf("debtPayoff: %v", err)
+			}
+			var order []string
+			for _, paid := range plan.PayoffOrder {
+				order = append(order, paid.Name)
+			}
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Fatalf("payoff order = %v, want %v", order, tt.want)
+			}
+			if last := plan.PayoffOrder[len(plan.PayoffOrder)-1]; last.Month != plan.Months {
+				t.Errorf("last debt closed in month %d, plan takes %d", last.Month, plan.Months)
+			}
+			if want := roundKopecks(70_000 + plan.TotalInterest); plan.TotalPaid != want {
+				t.Errorf("total paid = %v, want balances + interest = %v", plan.TotalPaid, want)
+			}
+			plans[tt.strategy] = plan
+		})
+	}
+	if plans[strategyAvalanche].TotalInterest >= plans[strategySnowball].TotalInterest {
+		t.Errorf("avalanche interest %v, want less than snowball %v",
+			plans[strategyAvalanche].TotalInterest, plans[strategySnowball].TotalInterest)
+	}
+}
+
+func TestDebtPayoffWithoutInterest(t *testing.T) {
+	plan, err := debtPayoff([]debtItem{{Name: "рассрочка", Balance: 100_000, MinPayment: 5_000}}, 10_000, strategyAvalanche)
+	if err != nil {
+		t.Fatalf("debtPayoff: %v", err)
+	}
+	if plan.Months != 10 || plan.TotalPaid != 100_000 || plan.TotalInterest != 0 {
+		t.Fatalf("plan = %+v, want 10 months, 100000 paid, no interest", plan)
+	}
+}
+
+func TestDebtPayoffErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		debts    []debtItem
+		budget   float64
+		strategy string
+		want     string
+	}{
+		{"бюджет меньше минимальных платежей",
+			[]debtItem{{Name: "кредитка", Balance: 50_000, AnnualRate: 30, MinPayment: 2_000}, {Name: "займ", Balance: 20_000, AnnualRate: 10, MinPayment: 1_000}},
+			2_500, strategyAvalanche, "less than the sum of minimum payments"},
+		// Платёж равен процентам: долг не уменьшается
+		{"не погашается за 600 месяцев",
+			[]debtItem{{Name: "ипотека", Balance: 1_000_000, AnnualRate: 12, MinPayment: 10_000}},
+			10_000, strategyAvalanche, "not paid off within 50 years"},
+		{"нет долгов", nil, 10_000, strategyAvalanche, "1 to 20 items"},
+		{"неизвестная стратегия", []debtItem{{Name: "займ", Balance: 1_000}}, 1_000, "random", "avalanche or snowball"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := debtPayoff(tt.debts, tt.budget, tt.strategy)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("debtPayoff error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
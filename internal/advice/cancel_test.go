@@ -0,0 +1,302 @@
+package advice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// scriptedProvider — FakeProvider, который первые toolRounds ответов просит
+// посчитать кредит, а перед каждым запросом вызывает hook (например, ждёт
+// отмены контекста, как зависшая модель)
+type scriptedProvider struct {
+	*FakeProvider
+	toolRounds int
+	hook       func(ctx context.Context, call int)
+
+	mu     sync.Mutex
+	calls  int
+	ctxErr error // ошибка контекста, которую увидел последний запрос
+}
+
+// toolRoundText — текст, который модель пишет перед вызовом инструмента
+const toolRoundText = "Сейчас посчитаю платёж. "
+
+func (p *scriptedProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	call := p.begin(ctx)
+	defer p.end(ctx)
+
+	if resp, ok := p.toolRound(call, req); ok {
+		return resp, nil
+	}
+	return p.FakeProvider.Complete(ctx, req)
+}
+
+func (p *scriptedProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error) {
+	call := p.begin(ctx)
+	defer p.end(ctx)
+
+	if resp, ok := p.toolRound(call, req); ok {
+		if err := onDelta(resp.Content); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	return p.FakeProvider.Stream(ctx, req, onDelta)
+}
+
+// toolRound просит посчитать кредит, пока не кончились toolRounds
+func (p *scriptedProvider) toolRound(call int, req ChatRequest) (*ChatResponse, bool) {
+	if call > p.toolRounds || !req.allowsTools() {
+		return nil, false
+	}
+	return &ChatResponse{Content: toolRoundText, ToolCalls: []ToolCall{{
+		ID:   "call-1",
+		Type: "function",
+		Function: ToolCallFunction{
+			Name:      toolLoanAmortization,
+			Arguments: `{"principal": 1000000, "annualRatePercent": 12, "months": 12}`,
+		},
+	}}}, true
+}
+
+func (p *scriptedProvider) begin(ctx context.Context) int {
+	p.mu.Lock()
+	p.calls++
+	call := p.calls
+	p.mu.Unlock()
+
+	if p.hook != nil {
+		p.hook(ctx, call)
+	}
+	return call
+}
+
+func (p *scriptedProvider) end(ctx context.Context) {
+	p.mu.Lock()
+	p.ctxErr = ctx.Err()
+	p.mu.Unlock()
+}
+
+// waitForCancel изображает модель, которая не отвечает, пока запрос не отменят
+func waitForCancel(ctx context.Context, _ int) {
+	<-ctx.Done()
+}
+
+func newTestHandler(provider LLMProvider, timeouts Timeouts) *Handler {
+	return NewHandler(NewService(provider, nil, nil, nil, NewToolbox(nil)), false, timeouts)
+}
+
+func adviceContext(ctx context.Context, accept string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/advice", strings.NewReader(`{"question": "Как накопить на квартиру?"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if accept != "" {
+		req.Header.Set(echo.HeaderAccept, accept)
+	}
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req.WithContext(ctx), rec), rec
+}
+
+func TestGetAdviceDeadlineCancelsProvider(t *testing.T) {
+	provider := &scriptedProvider{FakeProvider: NewFakeProvider(), hook: waitForCancel}
+	h := newTestHandler(provider, Timeouts{Advice: 20 * time.Millisecond})
+	c, _ := adviceContext(context.Background(), "")
+
+	err := h.GetAdvice(c)
+	if err != errAdviceTimeout {
+		t.Fatalf("GetAdvice error = %v, want errAdviceTimeout (504)", err)
+	}
+	if !errors.Is(provider.ctxErr, context.DeadlineExceeded) {
+		t.Fatalf("provider context error = %v, want deadline exceeded", provider.ctxErr)
+	}
+}
+
+func TestGetAdviceClientDisconnectCancelsProvider(t *testing.T) {
+	ctx, disconnect := context.WithCancel(context.Background())
+	provider := &scriptedProvider{
+		FakeProvider: NewFakeProvider(),
+		hook: func(ctx context.Context, call int) {
+			disconnect()
+			<-ctx.Done()
+		},
+	}
+	h := newTestHandler(provider, Timeouts{Advice: time.Minute})
+	c, _ := adviceContext(ctx, "")
+
+	err := h.GetAdvice(c)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetAdvice error = %v, want context.Canceled", err)
+	}
+	if !errors.Is(provider.ctxErr, context.Canceled) {
+		t.Fatalf("provider context error = %v, want canceled", provider.ctxErr)
+	}
+}
+
+func TestToolLoopStopsOnClientDisconnect(t *testing.T) {
+	ctx, disconnect := context.WithCancel(context.Background())
+	provider := &scriptedProvider{
+		FakeProvider: NewFakeProvider(),
+		toolRounds:   maxToolRounds,
+		// Клиент уходит, пока модель готовит вызов инструмента
+		hook: func(_ context.Context, call int) {
+			if call == 1 {
+				disconnect()
+			}
+		},
+	}
+	h := newTestHandler(provider, Timeouts{Advice: time.Minute})
+	c, _ := adviceContext(ctx, "")
+
+	err := h.GetAdvice(c)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetAdvice error = %v, want context.Canceled", err)
+	}
+	if provider.calls != 1 {
+		t.Fatalf("provider called %d times after disconnect, want 1", provider.calls)
+	}
+}
+
+func TestToolLoopStopsAtDeadline(t *testing.T) {
+	provider := &scriptedProvider{
+		FakeProvider: NewFakeProvider(),
+		toolRounds:   maxToolRounds,
+		// Второй раунд отвечает только после истечения бюджета
+		hook: func(ctx context.Context, call int) {
+			if call == 2 {
+				<-ctx.Done()
+			}
+		},
+	}
+	h := newTestHandler(provider, Timeouts{Advice: 20 * time.Millisecond})
+	c, _ := adviceContext(context.Background(), "")
+
+	err := h.GetAdvice(c)
+	if err != errAdviceTimeout {
+		t.Fatalf("GetAdvice error = %v, want errAdviceTimeout (504)", err)
+	}
+	if provider.calls != 2 {
+		t.Fatalf("provider called %d times, want the loop to stop after round 2", provider.calls)
+	}
+}
+
+// disconnectingWriter обрывает запрос после первого события "delta", как клиент,
+// закрывший вкладку посреди ответа
+type disconnectingWriter struct {
+	*httptest.ResponseRecorder
+	disconnect context.CancelFunc
+}
+
+func (w *disconnectingWriter) Write(p []byte) (int, error) {
+	if strings.HasPrefix(string(p), "event: delta") {
+		w.disconnect()
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamAdviceDisconnectStopsGeneration(t *testing.T) {
+	ctx, disconnect := context.WithCancel(context.Background())
+	provider := &scriptedProvider{FakeProvider: NewFakeProvider()}
+	// Без инструментов ответ идёт клиенту по мере генерации
+	h := NewHandler(NewService(provider, nil, nil, nil, nil), false, Timeouts{Stream: time.Minute})
+	c, rec := adviceContext(ctx, "text/event-stream")
+	c.Response().Writer = &disconnectingWriter{ResponseRecorder: rec, disconnect: disconnect}
+
+	if err := h.GetAdvice(c); err != nil {
+		t.Fatalf("GetAdvice: %v", err)
+	}
+
+	body := rec.Body.String()
+	if n := strings.Count(body, "event: delta"); n != 1 {
+		t.Fatalf("got %d delta events after disconnect, want 1:\n%s", n, body)
+	}
+	if strings.Contains(body, "event: done") {
+		t.Fatalf("stream finished after disconnect:\n%s", body)
+	}
+	if !errors.Is(provider.ctxErr, context.Canceled) {
+		t.Fatalf("provider context error = %v, want canceled", provider.ctxErr)
+	}
+}
+
+// hangingUpstream — OpenAI-совместимый сервер, который не отвечает, пока
+// клиент не оборвёт запрос. started закрывается, когда запрос дошёл до сервера,
+// cancelled — когда сервер увидел отмену
+type hangingUpstream struct {
+	*httptest.Server
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func newHangingUpstream(t *testing.T) *hangingUpstream {
+	t.Helper()
+	up := &hangingUpstream{started: make(chan struct{}), cancelled: make(chan struct{})}
+	var once sync.Once
+	up.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Обрыв соединения сервер замечает только после того, как прочитано тело
+		io.Copy(io.Discard, r.Body)
+		once.Do(func() { close(up.started) })
+		<-r.Context().Done()
+		close(up.cancelled)
+	}))
+	t.Cleanup(up.Close)
+	return up
+}
+
+// assertCancelled ждёт, пока сервер увидит отмену запроса
+func (up *hangingUpstream) assertCancelled(t *testing.T) {
+	t.Helper()
+	select {
+	case <-up.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request was not cancelled")
+	}
+}
+
+func TestOpenAIProviderDeadlineCancelsUpstream(t *testing.T) {
+	up := newHangingUpstream(t)
+	h := newTestHandler(NewOpenAIProvider(up.URL, "", "test-model"), Timeouts{Advice: 50 * time.Millisecond})
+	c, _ := adviceContext(context.Background(), "")
+
+	if err := h.GetAdvice(c); err != errAdviceTimeout {
+		t.Fatalf("GetAdvice error = %v, want errAdviceTimeout (504)", err)
+	}
+	up.assertCancelled(t)
+}
+
+func TestOpenAIProviderDisconnectCancelsUpstream(t *testing.T) {
+	up := newHangingUpstream(t)
+	h := newTestHandler(NewOpenAIProvider(up.URL, "", "test-model"), Timeouts{Advice: time.Minute})
+	ctx, disconnect := context.WithCancel(context.Background())
+	c, _ := adviceContext(ctx, "")
+
+	go func() {
+		<-up.started
+		disconnect()
+	}()
+	if err := h.GetAdvice(c); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetAdvice error = %v, want context.Canceled", err)
+	}
+	up.assertCancelled(t)
+}
+
+func TestOpenAIProviderStreamDeadlineCancelsUpstream(t *testing.T) {
+	up := newHangingUpstream(t)
+	provider := NewOpenAIProvider(up.URL, "", "test-model")
+	h := NewHandler(NewService(provider, nil, nil, nil, nil), false, Timeouts{Stream: 50 * time.Millisecond})
+	c, rec := adviceContext(context.Background(), "text/event-stream")
+
+	if err := h.GetAdvice(c); err != nil {
+		t.Fatalf("GetAdvice: %v", err)
+	}
+	up.assertCancelled(t)
+	if body := rec.Body.String(); !strings.Contains(body, "event: error") || !strings.Contains(body, errAdviceTimeout.Message) {
+		t.Fatalf("stream did not report the timeout:\n%s", body)
+	}
+}
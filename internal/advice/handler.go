@@ -1,16 +1,46 @@
 package advice
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
 	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
 	"github.com/labstack/echo/v4"
 )
 
+// Timeouts — сколько времени даётся на ответ модели по типу запроса; 0 — без ограничения.
+// Бюджет включает повторы запросов к провайдеру и конвертацию валют
+type Timeouts struct {
+	Advice  time.Duration // /advice, /advice/structured и уточняющие вопросы
+	Analyze time.Duration // /analyze
+	Stream  time.Duration // любые ответы через Server-Sent Events
+}
+
+var errAdviceTimeout = apperrors.New(http.StatusGatewayTimeout, "AI не успел ответить, попробуйте ещё раз")
+
 type Handler struct {
 	service *Service
+	// requireVerifiedEmail: не сохранять историю пользователей с неподтверждённым email
+	requireVerifiedEmail bool
+	timeouts             Timeouts
 }
 
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *Service, requireVerifiedEmail bool, timeouts Timeouts) *Handler {
+	return &Handler{
+		service:              service,
+		requireVerifiedEmail: requireVerifiedEmail,
+		timeouts:             timeouts,
+	}
+}
+
+// streamDelta — фрагмент ответа в событии "delta"
+type streamDelta struct {
+	Content string `json:"content"`
 }
 
 func (h *Handler) GetAdvice(c echo.Context) error {
@@ -23,14 +53,51 @@ func (h *Handler) GetAdvice(c echo.Context) error {
 		return apperrors.NewWithDetails(400, "Пожалуйста, введите вопрос", "question field is required")
 	}
 
-	answer, err := h.service.GetAdvice(req.Question)
+	if wantsEventStream(c) {
+		return h.streamAdvice(c, req)
+	}
+
+	ctx, cancel := withBudget(c, h.timeouts.Advice)
+	defer cancel()
+
+	result, err := h.service.GetAdvice(ctx, h.persistUserID(c), req.Question)
 	if err != nil {
-		return err
+		return budgetError(err)
 	}
 
-	return c.JSON(200, AdviceResponse{
-		Answer: answer,
+	return c.JSON(200, result)
+}
+
+// StreamAdvice отдаёт совет через Server-Sent Events
+func (h *Handler) StreamAdvice(c echo.Context) error {
+	var req AdviceRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if req.Question == "" {
+		return apperrors.NewWithDetails(400, "Пожалуйста, введите вопрос", "question field is required")
+	}
+
+	return h.streamAdvice(c, req)
+}
+
+func (h *Handler) streamAdvice(c echo.Context, req AdviceRequest) error {
+	stream := newSSEWriter(c)
+
+	// Контекст запроса отменяется при обрыве соединения — вместе с ним
+	// прерывается и запрос к модели
+	ctx, cancel := withBudget(c, h.timeouts.Stream)
+	defer cancel()
+
+	result, err := h.service.StreamAdvice(ctx, h.persistUserID(c), req.Question, func(delta string) error {
+		return stream.send("delta", streamDelta{Content: delta})
 	})
+	if err != nil {
+		return sendStreamError(stream, err)
+	}
+
+	return stream.send("done", result)
 }
 
 func (h *Handler) Analyze(c echo.Context) error {
@@ -44,9 +111,12 @@ func (h *Handler) Analyze(c echo.Context) error {
 		return apperrors.NewWithDetails(400, "Пожалуйста, заполните все обязательные поля", "status, expenses, and income are required")
 	}
 
-	result, err := h.service.AnalyzeFinances(req)
+	ctx, cancel := withBudget(c, h.timeouts.Analyze)
+	defer cancel()
+
+	result, err := h.service.AnalyzeFinances(ctx, h.persistUserID(c), req)
 	if err != nil {
-		return err
+		return budgetError(err)
 	}
 
 	return c.JSON(200, result)
@@ -59,6 +129,239 @@ func (h *Handler) GetStructuredAdvice(c echo.Context) error {
 		return apperrors.NewWithDetails(400, "Неверный формат запроса", err.Error())
 	}
 
+	if err := h.service.FillFromProfile(c.Request().Context(), profileUserID(c), &req); err != nil {
+		return err
+	}
+
+	if err := validateStructuredRequest(req); err != nil {
+		return err
+	}
+
+	if wantsEventStream(c) {
+		return h.streamStructuredAdvice(c, req)
+	}
+
+	ctx, cancel := withBudget(c, h.timeouts.Advice)
+	defer cancel()
+
+	result, err := h.service.GetStructuredAdvice(ctx, h.persistUserID(c), req)
+	if err != nil {
+		return budgetError(err)
+	}
+
+	return c.JSON(200, result)
+}
+
+// StreamStructuredAdvice отдаёт структурированный совет через Server-Sent Events.
+// Итоги по доходам и расходам приходят в финальном событии "done".
+func (h *Handler) StreamStructuredAdvice(c echo.Context) error {
+	var req StructuredAdviceRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.NewWithDetails(400, "Неверный формат запроса", err.Error())
+	}
+
+	if err := h.service.FillFromProfile(c.Request().Context(), profileUserID(c), &req); err != nil {
+		return err
+	}
+
+	if err := validateStructuredRequest(req); err != nil {
+		return err
+	}
+
+	return h.streamStructuredAdvice(c, req)
+}
+
+func (h *Handler) streamStructuredAdvice(c echo.Context, req StructuredAdviceRequest) error {
+	stream := newSSEWriter(c)
+
+	ctx, cancel := withBudget(c, h.timeouts.Stream)
+	defer cancel()
+
+	result, err := h.service.StreamStructuredAdvice(ctx, h.persistUserID(c), req, func(delta string) error {
+		return stream.send("delta", streamDelta{Content: delta})
+	})
+	if err != nil {
+		return sendStreamError(stream, err)
+	}
+
+	return stream.send("done", result)
+}
+
+// FollowUp задаёт уточняющий вопрос в рамках сохранённой сессии.
+// Модель получает всю предыдущую переписку, поэтому можно спросить
+// «а что с кредиткой?» без повторения исходных данных.
+func (h *Handler) FollowUp(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	var req FollowUpRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if req.Question == "" {
+		return apperrors.NewWithDetails(400, "Пожалуйста, введите вопрос", "question field is required")
+	}
+
+	userID := currentUserID(c)
+
+	if wantsEventStream(c) {
+		stream := newSSEWriter(c)
+		ctx, cancel := withBudget(c, h.timeouts.Stream)
+		defer cancel()
+
+		result, err := h.service.StreamContinueSession(ctx, userID, sessionID, req.Question, func(delta string) error {
+			return stream.send("delta", streamDelta{Content: delta})
+		})
+		if err != nil {
+			return sendStreamError(stream, err)
+		}
+		return stream.send("done", result)
+	}
+
+	ctx, cancel := withBudget(c, h.timeouts.Advice)
+	defer cancel()
+
+	result, err := h.service.ContinueSession(ctx, userID, sessionID, req.Question)
+	if err != nil {
+		return budgetError(err)
+	}
+
+	return c.JSON(200, result)
+}
+
+// ListSessions возвращает сессии пользователя постранично (?cursor=&limit=)
+func (h *Handler) ListSessions(c echo.Context) error {
+	limit := 0
+	if raw := c.QueryParam("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil {
+			return apperrors.NewWithDetails(400, "Неверный параметр limit", err.Error())
+		}
+	}
+
+	result, err := h.service.ListSessions(c.Request().Context(), currentUserID(c), c.QueryParam("cursor"), limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result)
+}
+
+func (h *Handler) GetSession(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	result, err := h.service.GetSession(c.Request().Context(), currentUserID(c), sessionID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result)
+}
+
+func (h *Handler) RenameSession(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	var req RenameSessionRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	ctx := c.Request().Context()
+	userID := currentUserID(c)
+	if err := h.service.RenameSession(ctx, userID, sessionID, req.Title); err != nil {
+		return err
+	}
+
+	result, err := h.service.GetSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, result.Session)
+}
+
+func (h *Handler) DeleteSession(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	if err := h.service.DeleteSession(c.Request().Context(), currentUserID(c), sessionID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ExportSession отдаёт сессию файлом (?format=markdown|json, по умолчанию markdown)
+func (h *Handler) ExportSession(c echo.Context) error {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrNotFound
+	}
+
+	format := c.QueryParam("format")
+	if format == "" || format == "md" {
+		format = ExportFormatMarkdown
+	}
+
+	data, err := h.service.ExportSession(c.Request().Context(), currentUserID(c), sessionID, format)
+	if err != nil {
+		return err
+	}
+
+	contentType, ext := "text/markdown; charset=utf-8", "md"
+	if format == ExportFormatJSON {
+		contentType, ext = echo.MIMEApplicationJSONCharsetUTF8, "json"
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="session-%d.%s"`, sessionID, ext))
+	return c.Blob(200, contentType, data)
+}
+
+// persistUserID возвращает id пользователя, для которого нужно сохранять историю:
+// 0 для анонимов, для API-ключей без sessions:write и, если этого требует политика,
+// для неподтверждённых email
+func (h *Handler) persistUserID(c echo.Context) int {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil || !principal.HasScope(middleware.ScopeSessionsWrite) {
+		return 0
+	}
+	if h.requireVerifiedEmail && !principal.EmailVerified {
+		return 0
+	}
+	return principal.UserID
+}
+
+// profileUserID возвращает id пользователя, чьим профилем можно дополнить запрос:
+// 0 для анонимов и API-ключей без profile:read
+func profileUserID(c echo.Context) int {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil || !principal.HasScope(middleware.ScopeProfileRead) {
+		return 0
+	}
+	return principal.UserID
+}
+
+// currentUserID возвращает id пользователя из токена или 0 для анонимного запроса
+func currentUserID(c echo.Context) int {
+	if userID, ok := c.Get("user_id").(int); ok {
+		return userID
+	}
+	return 0
+}
+
+func validateStructuredRequest(req StructuredAdviceRequest) error {
 	// Валидация: должен быть хотя бы 1 источник дохода и расхода
 	if len(req.IncomeSources) == 0 {
 		return apperrors.NewWithDetails(400, "Укажите хотя бы один источник дохода", "incomeSources is required")
@@ -66,12 +369,34 @@ func (h *Handler) GetStructuredAdvice(c echo.Context) error {
 	if len(req.ExpenseSources) == 0 {
 		return apperrors.NewWithDetails(400, "Укажите хотя бы один источник расхода", "expenseSources is required")
 	}
+	return nil
+}
 
-	result, err := h.service.GetStructuredAdvice(c.Request().Context(), req)
-	if err != nil {
-		return err
+// withBudget ограничивает контекст запроса бюджетом времени эндпоинта.
+// Обрыв соединения клиентом по-прежнему отменяет его сразу
+func withBudget(c echo.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(c.Request().Context())
 	}
+	return context.WithTimeout(c.Request().Context(), budget)
+}
 
-	return c.JSON(200, result)
+// budgetError превращает истёкший бюджет в 504 для клиента
+func budgetError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errAdviceTimeout
+	}
+	return err
 }
 
+// sendStreamError сообщает об ошибке событием "error": заголовки уже отправлены,
+// и ErrorHandler не сможет ответить JSON
+func sendStreamError(stream *sseWriter, err error) error {
+	appErr, ok := budgetError(err).(*apperrors.AppError)
+	if !ok {
+		appErr = apperrors.ErrGroqAPIUnavailable
+	}
+	// Если клиент уже отключился, запись просто не удастся — это не ошибка сервера
+	_ = stream.send("error", appErr)
+	return nil
+}
@@ -1,11 +1,17 @@
 package advice
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type AdviceRequest struct {
 	Question string `json:"question" validate:"required"`
 }
 
 type AdviceResponse struct {
-	Answer string `json:"answer"`
+	Answer    string `json:"answer"`
+	SessionID int    `json:"sessionId,omitempty"`
 }
 
 type StructuredAdviceResponse struct {
@@ -13,6 +19,51 @@ type StructuredAdviceResponse struct {
 	TotalIncomeRUB    float64 `json:"totalIncomeRUB"`
 	TotalExpensesRUB  float64 `json:"totalExpensesRUB"`
 	BalanceRUB        float64 `json:"balanceRUB"`
+	SessionID         int     `json:"sessionId,omitempty"`
+}
+
+// FollowUpRequest — уточняющий вопрос в рамках существующей сессии
+type FollowUpRequest struct {
+	Question string `json:"question" validate:"required"`
+}
+
+// Сессии диалога с ИИ (таблицы advice_sessions и advice_messages)
+type Session struct {
+	ID              int             `json:"id"`
+	UserID          int             `json:"-"`
+	Title           string          `json:"title"`
+	ContextSnapshot json.RawMessage `json:"contextSnapshot,omitempty"`
+	CreatedAt       time.Time       `json:"createdAt"`
+}
+
+type SessionMessage struct {
+	ID        int       `json:"id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SessionSummary — элемент списка сессий (без сообщений и снапшота)
+type SessionSummary struct {
+	ID           int       `json:"id"`
+	Title        string    `json:"title"`
+	MessageCount int       `json:"messageCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type SessionListResponse struct {
+	Sessions   []SessionSummary `json:"sessions"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// SessionDetails — сессия целиком: исходные данные и вся переписка
+type SessionDetails struct {
+	Session
+	Messages []SessionMessage `json:"messages"`
+}
+
+type RenameSessionRequest struct {
+	Title string `json:"title" validate:"required"`
 }
 
 // Новые модели для финансового анализа
@@ -24,8 +75,25 @@ type AnalysisRequest struct {
 }
 
 type AnalysisResponse struct {
-	Balance string `json:"balance"`
-	Advice  string `json:"advice"`
+	// Balance и Advice — текстовый вид отчёта для старых клиентов
+	Balance          string         `json:"balance"`
+	Advice           string         `json:"advice"`
+	IncomeItems      []AnalysisItem `json:"incomeItems"`
+	ExpenseItems     []AnalysisItem `json:"expenseItems"`
+	TotalIncomeRUB   float64        `json:"totalIncomeRUB"`
+	TotalExpensesRUB float64        `json:"totalExpensesRUB"`
+	BalanceRUB       float64        `json:"balanceRUB"`
+	RiskLevel        string         `json:"riskLevel"` // low, medium или high
+	Summary          string         `json:"summary"`
+	Recommendations  []string       `json:"recommendations"`
+	SessionID        int            `json:"sessionId,omitempty"`
+}
+
+// AnalysisItem — статья дохода или расхода, найденная в тексте пользователя
+type AnalysisItem struct {
+	Name      string  `json:"name"`
+	AmountRUB float64 `json:"amountRUB"` // в месяц
+	Source    string  `json:"source"`    // фрагмент текста, из которого взята сумма
 }
 
 // Структурированные модели для конвертации валют
@@ -0,0 +1,103 @@
+package advice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/pkg/config"
+)
+
+// Поддерживаемые провайдеры языковых моделей
+const (
+	ProviderGroq   = "groq"
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+// Message — одно сообщение диалога с моделью
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls — вызовы инструментов в ответе модели (role "assistant")
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID связывает результат инструмента (role "tool") с вызовом
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Tool — описание инструмента для модели в формате OpenAI tools
+type Tool struct {
+	Type     string       `json:"type"` // всегда "function"
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"` // JSON Schema аргументов
+}
+
+// ToolCall — запрос модели вызвать инструмент
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON-объект строкой, как его прислала модель
+}
+
+// ChatRequest описывает запрос к языковой модели
+type ChatRequest struct {
+	Messages []Message
+	// JSONMode просит модель вернуть ровно один JSON-объект; схему описывает промпт
+	JSONMode bool
+	// Tools — инструменты, которые модель может вызвать вместо ответа
+	Tools []Tool
+	// ToolChoice: "none" — отвечать только текстом; пусто — на усмотрение модели
+	ToolChoice string
+}
+
+// ChatResponse — ответ языковой модели
+type ChatResponse struct {
+	Content string
+	// ToolCalls не пуст, если модель просит вызвать инструменты
+	ToolCalls []ToolCall
+}
+
+// LLMProvider скрывает конкретного поставщика модели от кода промптов
+type LLMProvider interface {
+	Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// Stream отдаёт ответ по частям через onDelta и возвращает собранный текст.
+	// Ошибка из onDelta прерывает генерацию.
+	Stream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error)
+}
+
+// retryBaseDelay — пауза перед первым повтором запроса к модели
+const retryBaseDelay = 500 * time.Millisecond
+
+// NewProvider создаёт провайдера, выбранного в конфигурации.
+// Сетевые провайдеры оборачиваются повторами и автоматом отключения
+func NewProvider(cfg *config.Config) (LLMProvider, error) {
+	resilience := ResilienceConfig{
+		MaxRetries:       cfg.LLMMaxRetries,
+		BaseDelay:        retryBaseDelay,
+		MaxDelay:         cfg.LLMRetryMaxDelay,
+		FailureThreshold: cfg.LLMBreakerThreshold,
+		OpenTimeout:      cfg.LLMBreakerCooldown,
+	}
+
+	switch cfg.LLMProvider {
+	case ProviderGroq:
+		return NewResilientProvider(ProviderGroq, NewGroqProvider(cfg.GroqAPIKey, cfg.LLMModel), resilience), nil
+	case ProviderOpenAI:
+		return NewResilientProvider(ProviderOpenAI, NewOpenAIProvider(cfg.LLMBaseURL, cfg.LLMAPIKey, cfg.LLMModel), resilience), nil
+	case ProviderFake:
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %q", cfg.LLMProvider)
+	}
+}
@@ -0,0 +1,74 @@
+package advice
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// FakeProvider — детерминированный провайдер без сети для тестов и офлайн-разработки.
+// На одинаковый запрос всегда возвращает одинаковый ответ.
+type FakeProvider struct{}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+// fakeAnalysisReport соответствует analysisSchema
+const fakeAnalysisReport = `{
+  "riskLevel": "low",
+  "summary": "Это тестовый ответ: внешняя модель не вызывалась.",
+  "recommendations": ["Подключите настоящую модель, чтобы получить рекомендации."]
+}`
+
+func (p *FakeProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	// Как и сетевые провайдеры, отдаём ошибку контекста: по ней обработчик
+	// отличает истёкший бюджет (504) от обрыва соединения
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// В JSON mode ждут отчёт анализа — отдаём его в нужном формате
+	if req.JSONMode {
+		return &ChatResponse{Content: fakeAnalysisReport}, nil
+	}
+
+	question := lastUserMessage(req.Messages)
+
+	sum := sha256.Sum256([]byte(question))
+	return &ChatResponse{
+		Content: fmt.Sprintf("Тестовый ответ %x: вопрос из %d символов, сообщений в диалоге: %d.",
+			sum[:4], utf8.RuneCountInString(question), len(req.Messages)),
+	}, nil
+}
+
+func (p *FakeProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error) {
+	resp, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Отдаём ответ по словам, как это делают настоящие модели
+	for _, word := range strings.SplitAfter(resp.Content, " ") {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// lastUserMessage возвращает текст последнего сообщения пользователя
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,296 @@
+package advice
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+const (
+	groqBaseURL      = "https://api.groq.com/openai/v1"
+	groqDefaultModel = "llama-3.3-70b-versatile"
+)
+
+// OpenAIProvider работает с любым OpenAI-совместимым API (Groq, Ollama, llama.cpp)
+type OpenAIProvider struct {
+	name       string
+	baseURL    string
+	apiKey     string
+	model      string
+	requireKey bool
+	// httpClient без собственного таймаута: запрос ограничивает контекст
+	// с бюджетом эндпоинта (ANALYZE_TIMEOUT, ADVICE_STREAM_TIMEOUT и т.д.)
+	httpClient *http.Client
+}
+
+// NewGroqProvider создаёт провайдера для Groq
+func NewGroqProvider(apiKey, model string) *OpenAIProvider {
+	if model == "" {
+		model = groqDefaultModel
+	}
+	return &OpenAIProvider{
+		name:       "Groq",
+		baseURL:    groqBaseURL,
+		apiKey:     apiKey,
+		model:      model,
+		requireKey: true,
+		httpClient: &http.Client{},
+	}
+}
+
+// NewOpenAIProvider создаёт провайдера для произвольного OpenAI-совместимого сервера.
+// Ключ необязателен: локальные серверы обычно работают без него.
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		name:       "LLM",
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{},
+	}
+}
+
+type chatCompletionRequest struct {
+	Messages       []Message       `json:"messages"`
+	Model          string          `json:"model"`
+	Stream         bool            `json:"stream,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Tools          []Tool          `json:"tools,omitempty"`
+	ToolChoice     string          `json:"tool_choice,omitempty"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+// formatFor включает JSON mode (response_format: json_object) для запросов, которые его просят
+func formatFor(req ChatRequest) *responseFormat {
+	if !req.JSONMode {
+		return nil
+	}
+	return &responseFormat{Type: "json_object"}
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message struct {
+			Content   string     `json:"content"`
+			ToolCalls []ToolCall `json:"tool_calls"`
+		} `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string          `json:"content"`
+			ToolCalls []toolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if p.requireKey && p.apiKey == "" {
+		return nil, apperrors.ErrGroqAPIUnavailable
+	}
+
+	httpReq, err := p.newRequest(ctx, chatCompletionRequest{
+		Messages:       req.Messages,
+		Model:          p.model,
+		ResponseFormat: formatFor(req),
+		Tools:          req.Tools,
+		ToolChoice:     req.ToolChoice,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, p.transportError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, p.transportError(ctx, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, p.statusError(resp, body)
+	}
+
+	var chatResp chatCompletionResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка десериализации ответа")
+	}
+
+	if chatResp.Error != nil {
+		return nil, apperrors.NewWithDetails(503, "Ошибка от "+p.name, chatResp.Error.Message)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return nil, apperrors.New(503, "Модель не вернула текст ответа")
+	}
+
+	message := chatResp.Choices[0].Message
+	return &ChatResponse{Content: message.Content, ToolCalls: message.ToolCalls}, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error) {
+	if p.requireKey && p.apiKey == "" {
+		return nil, apperrors.ErrGroqAPIUnavailable
+	}
+
+	httpReq, err := p.newRequest(ctx, chatCompletionRequest{
+		Messages:       req.Messages,
+		Model:          p.model,
+		Stream:         true,
+		ResponseFormat: formatFor(req),
+		Tools:          req.Tools,
+		ToolChoice:     req.ToolChoice,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, p.transportError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, p.statusError(resp, body)
+	}
+
+	// Ответ приходит в формате SSE: строки "data: {...}", завершение — "data: [DONE]".
+	// Вызовы инструментов приходят кусками: id и имя в первом, аргументы дописываются
+	var answer strings.Builder
+	var toolCalls []ToolCall
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка десериализации ответа")
+		}
+		if chunk.Error != nil {
+			return nil, apperrors.NewWithDetails(503, "Ошибка от "+p.name, chunk.Error.Message)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		toolCalls = mergeToolCallDeltas(toolCalls, chunk.Choices[0].Delta.ToolCalls)
+		if chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		answer.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, p.transportError(ctx, err)
+	}
+
+	return &ChatResponse{Content: answer.String(), ToolCalls: toolCalls}, nil
+}
+
+// toolCallDelta — фрагмент вызова инструмента в потоковом ответе
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// mergeToolCallDeltas собирает вызовы инструментов из фрагментов по index
+func mergeToolCallDeltas(calls []ToolCall, deltas []toolCallDelta) []ToolCall {
+	for _, d := range deltas {
+		if d.Index < 0 || d.Index >= maxToolCallsPerRound {
+			continue
+		}
+		for len(calls) <= d.Index {
+			calls = append(calls, ToolCall{Type: "function"})
+		}
+		call := &calls[d.Index]
+		if d.ID != "" {
+			call.ID = d.ID
+		}
+		if d.Type != "" {
+			call.Type = d.Type
+		}
+		call.Function.Name += d.Function.Name
+		call.Function.Arguments += d.Function.Arguments
+	}
+	return calls
+}
+
+// transportError различает отмену запроса клиентом и сбой сети:
+// первое не повторяется и не считается отказом провайдера
+func (p *OpenAIProvider) transportError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &UpstreamError{Provider: p.name, Err: err}
+}
+
+// statusError описывает неуспешный ответ API вместе с Retry-After
+func (p *OpenAIProvider) statusError(resp *http.Response, body []byte) error {
+	return &UpstreamError{
+		Provider:   p.name,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Body:       strings.ToValidUTF8(string(body[:min(len(body), maxErrorBody)]), ""),
+	}
+}
+
+// newRequest собирает HTTP-запрос к /chat/completions
+func (p *OpenAIProvider) newRequest(ctx context.Context, body chatCompletionRequest) (*http.Request, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка сериализации запроса")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка создания запроса")
+	}
+
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return httpReq, nil
+}
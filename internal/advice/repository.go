@@ -0,0 +1,168 @@
+package advice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrSessionNotFound — сессии нет или она принадлежит другому пользователю
+var ErrSessionNotFound = errors.New("advice session not found")
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// CreateSession создаёт сессию диалога; snapshot сохраняется в context_snapshot (может быть nil)
+func (r *Repository) CreateSession(ctx context.Context, userID int, title string, snapshot json.RawMessage) (*Session, error) {
+	var session Session
+	var rawSnapshot []byte
+	if len(snapshot) > 0 {
+		rawSnapshot = snapshot
+	}
+
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO advice_sessions (user_id, title, context_snapshot)
+		 VALUES ($1, $2, $3)
+		 RETURNING id, user_id, title, created_at`,
+		userID, title, rawSnapshot,
+	).Scan(&session.ID, &session.UserID, &session.Title, &session.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create advice session: %w", err)
+	}
+
+	session.ContextSnapshot = snapshot
+	return &session, nil
+}
+
+// GetSession возвращает сессию, только если она принадлежит пользователю
+func (r *Repository) GetSession(ctx context.Context, sessionID, userID int) (*Session, error) {
+	var session Session
+	var title sql.NullString
+	var snapshot []byte
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, title, context_snapshot, created_at
+		 FROM advice_sessions WHERE id = $1 AND user_id = $2`,
+		sessionID, userID,
+	).Scan(&session.ID, &session.UserID, &title, &snapshot, &session.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get advice session: %w", err)
+	}
+
+	session.Title = title.String
+	if len(snapshot) > 0 {
+		session.ContextSnapshot = json.RawMessage(snapshot)
+	}
+	return &session, nil
+}
+
+func (r *Repository) AddMessage(ctx context.Context, sessionID int, role, content string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO advice_messages (session_id, role, content) VALUES ($1, $2, $3)`,
+		sessionID, role, content,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add advice message: %w", err)
+	}
+	return nil
+}
+
+// GetMessages возвращает сообщения сессии в хронологическом порядке
+func (r *Repository) GetMessages(ctx context.Context, sessionID int) ([]SessionMessage, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, role, content, created_at
+		 FROM advice_messages WHERE session_id = $1
+		 ORDER BY id`,
+		sessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get advice messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []SessionMessage{}
+	for rows.Next() {
+		var msg SessionMessage
+		if err := rows.Scan(&msg.ID, &msg.Role, &msg.Content, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan advice message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// ListSessions возвращает сессии пользователя от новых к старым.
+// cursor — id последней сессии предыдущей страницы (0 для первой страницы).
+func (r *Repository) ListSessions(ctx context.Context, userID, cursor, limit int) ([]SessionSummary, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT s.id, COALESCE(s.title, ''), s.created_at,
+		        (SELECT COUNT(*) FROM advice_messages m WHERE m.session_id = s.id AND m.role <> 'tool')
+		 FROM advice_sessions s
+		 WHERE s.user_id = $1 AND ($2 = 0 OR s.id < $2)
+		 ORDER BY s.id DESC
+		 LIMIT $3`,
+		userID, cursor, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list advice sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []SessionSummary{}
+	for rows.Next() {
+		var session SessionSummary
+		if err := rows.Scan(&session.ID, &session.Title, &session.CreatedAt, &session.MessageCount); err != nil {
+			return nil, fmt.Errorf("failed to scan advice session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (r *Repository) RenameSession(ctx context.Context, sessionID, userID int, title string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE advice_sessions SET title = $1 WHERE id = $2 AND user_id = $3`,
+		title, sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to rename advice session: %w", err)
+	}
+	return requireAffected(res)
+}
+
+// DeleteSession удаляет сессию; сообщения удаляются каскадно
+func (r *Repository) DeleteSession(ctx context.Context, sessionID, userID int) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM advice_sessions WHERE id = $1 AND user_id = $2`,
+		sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete advice session: %w", err)
+	}
+	return requireAffected(res)
+}
+
+// requireAffected превращает «ноль затронутых строк» в ErrSessionNotFound
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
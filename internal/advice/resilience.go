@@ -0,0 +1,307 @@
+package advice
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// UpstreamError — неудачное обращение к API модели. По нему ResilientProvider
+// решает, повторять ли запрос и считать ли его отказом провайдера
+type UpstreamError struct {
+	Provider   string
+	StatusCode int           // 0 — ответа не было (сеть, таймаут)
+	RetryAfter time.Duration // из заголовка Retry-After, 0 — не задан
+	Body       string
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s request failed: %v", e.Provider, e.Err)
+	}
+	return fmt.Sprintf("%s returned status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable: сетевые сбои, 429 и 5xx проходят сами, остальные 4xx — ошибка запроса или ключа
+func (e *UpstreamError) Retryable() bool {
+	return e.StatusCode == 0 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// maxErrorBody — сколько байт тела ошибки сохраняем в UpstreamError
+const maxErrorBody = 512
+
+// parseRetryAfter понимает обе формы заголовка: секунды и HTTP-дату
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+var (
+	errCircuitOpen = errors.New("circuit breaker is open")
+
+	errLLMOverloaded = apperrors.New(http.StatusServiceUnavailable, "AI сервис перегружен, попробуйте позже")
+)
+
+// ResilienceConfig — параметры повторов и автомата отключения
+type ResilienceConfig struct {
+	MaxRetries int           // повторов после первой попытки
+	BaseDelay  time.Duration // первая пауза, дальше удваивается
+	MaxDelay   time.Duration // потолок паузы; больший Retry-After не ждём, а отдаём клиенту
+	// FailureThreshold отказов подряд размыкают цепь на OpenTimeout,
+	// затем один пробный запрос решает, замкнуть её или снова разомкнуть
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+// llmMetrics публикуются через expvar: ключи вида "<провайдер>.<счётчик>"
+var llmMetrics = expvar.NewMap("llm")
+
+// ResilientProvider оборачивает провайдера повторами с экспоненциальной паузой
+// и автоматом отключения (circuit breaker), чтобы не добивать упавший API
+type ResilientProvider struct {
+	name    string
+	next    LLMProvider
+	cfg     ResilienceConfig
+	breaker *circuitBreaker
+}
+
+func NewResilientProvider(name string, next LLMProvider, cfg ResilienceConfig) *ResilientProvider {
+	p := &ResilientProvider{
+		name:    name,
+		next:    next,
+		cfg:     cfg,
+		breaker: newCircuitBreaker(cfg.FailureThreshold, cfg.OpenTimeout),
+	}
+	llmMetrics.Set(name+".circuit_state", expvar.Func(func() any { return p.breaker.stateName() }))
+	return p
+}
+
+func (p *ResilientProvider) Complete(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	var resp *ChatResponse
+	err := p.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = p.next.Complete(ctx, req)
+		return err
+	}, func() bool { return true })
+	return resp, err
+}
+
+// Stream повторяет запрос, только пока клиенту не ушло ни одного фрагмента:
+// иначе ответ склеился бы из двух разных генераций
+func (p *ResilientProvider) Stream(ctx context.Context, req ChatRequest, onDelta func(delta string) error) (*ChatResponse, error) {
+	started := false
+	var resp *ChatResponse
+	err := p.do(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = p.next.Stream(ctx, req, func(delta string) error {
+			started = true
+			return onDelta(delta)
+		})
+		return err
+	}, func() bool { return !started })
+	return resp, err
+}
+
+func (p *ResilientProvider) do(ctx context.Context, call func(ctx context.Context) error, canRetry func() bool) error {
+	for attempt := 0; ; attempt++ {
+		if wait, err := p.breaker.allow(); err != nil {
+			llmMetrics.Add(p.name+".rejected", 1)
+			return apperrors.WithRetryAfter(apperrors.ErrGroqAPIUnavailable, wait)
+		}
+
+		llmMetrics.Add(p.name+".requests", 1)
+		err := call(ctx)
+		if opened := p.breaker.record(err); opened {
+			llmMetrics.Add(p.name+".circuit_opened", 1)
+			log.Printf("LLM provider %s: circuit opened for %s", p.name, p.cfg.OpenTimeout)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		var upstream *UpstreamError
+		if !errors.As(err, &upstream) {
+			return err
+		}
+		llmMetrics.Add(p.name+".failures", 1)
+		if !upstream.Retryable() || attempt >= p.cfg.MaxRetries || !canRetry() {
+			return upstreamAppError(upstream)
+		}
+
+		delay := p.backoff(attempt)
+		if upstream.RetryAfter > delay {
+			delay = upstream.RetryAfter
+		}
+		// Ждать дольше потолка или дедлайна запроса бессмысленно — пусть клиент повторит сам
+		if delay > p.cfg.MaxDelay {
+			return upstreamAppError(upstream)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return upstreamAppError(upstream)
+		}
+
+		llmMetrics.Add(p.name+".retries", 1)
+		log.Printf("LLM provider %s: %v, retry %d in %s", p.name, upstream, attempt+1, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff — экспоненциальная пауза с джиттером: случайное значение от половины
+// до целого интервала, чтобы клиенты не повторяли запросы синхронно
+func (p *ResilientProvider) backoff(attempt int) time.Duration {
+	d := p.cfg.BaseDelay << attempt
+	if d <= 0 || d > p.cfg.MaxDelay {
+		d = p.cfg.MaxDelay
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// upstreamAppError превращает окончательную ошибку провайдера в ответ клиенту
+func upstreamAppError(err *UpstreamError) error {
+	switch {
+	case err.StatusCode == http.StatusTooManyRequests:
+		return apperrors.WithRetryAfter(errLLMOverloaded, err.RetryAfter)
+	case err.StatusCode == 0:
+		return apperrors.ErrGroqAPIUnavailable
+	default:
+		return apperrors.NewWithDetails(http.StatusServiceUnavailable, err.Provider+" API недоступен",
+			fmt.Sprintf("status: %d, body: %s", err.StatusCode, err.Body))
+	}
+}
+
+// Состояния автомата отключения
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	timeout   time.Duration
+
+	state    int
+	failures int       // отказов подряд в замкнутом состоянии
+	openedAt time.Time // когда цепь последний раз разомкнулась
+	probing  bool      // в полуоткрытом состоянии уже идёт пробный запрос
+}
+
+func newCircuitBreaker(threshold int, timeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, timeout: timeout}
+}
+
+// allow решает, пускать ли запрос. При отказе возвращает, сколько ждать до пробы
+func (b *circuitBreaker) allow() (time.Duration, error) {
+	if b.threshold <= 0 {
+		return 0, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if wait := b.timeout - time.Since(b.openedAt); wait > 0 {
+			return wait, errCircuitOpen
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return 0, nil
+	case circuitHalfOpen:
+		if b.probing {
+			return b.timeout, errCircuitOpen
+		}
+		b.probing = true
+		return 0, nil
+	default:
+		return 0, nil
+	}
+}
+
+// record учитывает результат запроса и сообщает, разомкнулась ли цепь.
+// Отмена клиентом и ошибки запроса (4xx) о здоровье провайдера не говорят
+func (b *circuitBreaker) record(err error) (opened bool) {
+	if b.threshold <= 0 {
+		return false
+	}
+
+	var upstream *UpstreamError
+	failed := errors.As(err, &upstream) && upstream.Retryable()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.probing = false
+		switch {
+		case failed:
+			b.state, b.openedAt = circuitOpen, time.Now()
+			return true
+		case err == nil:
+			b.state, b.failures = circuitClosed, 0
+		}
+		return false
+	}
+
+	switch {
+	case failed:
+		b.failures++
+		if b.state == circuitClosed && b.failures >= b.threshold {
+			b.state, b.openedAt = circuitOpen, time.Now()
+			return true
+		}
+	case err == nil:
+		b.failures = 0
+	}
+	return false
+}
+
+func (b *circuitBreaker) stateName() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
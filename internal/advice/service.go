@@ -1,15 +1,12 @@
 package advice
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
-	"time"
 
+	"github.com/Kir-Khorev/finopp-back/internal/profile"
 	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
 )
 
@@ -17,119 +14,124 @@ type CurrencyConverter interface {
 	ConvertToRUB(ctx context.Context, amount float64, fromCurrency string) (float64, error)
 }
 
+// ProfileProvider отдаёт сохранённый финансовый профиль пользователя
+type ProfileProvider interface {
+	GetProfile(ctx context.Context, userID int) (*profile.Profile, error)
+}
+
 type Service struct {
-	groqAPIKey        string
-	httpClient        *http.Client
+	llm               LLMProvider
 	currencyConverter CurrencyConverter
+	repo              *Repository
+	profiles          ProfileProvider
+	// tools — калькуляторы для модели; nil — модель отвечает без инструментов
+	tools *Toolbox
 }
 
-func NewService(groqAPIKey string, currencyConverter CurrencyConverter) *Service {
+func NewService(llm LLMProvider, currencyConverter CurrencyConverter, repo *Repository, profiles ProfileProvider, tools *Toolbox) *Service {
 	return &Service{
-		groqAPIKey:        groqAPIKey,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		llm:               llm,
 		currencyConverter: currencyConverter,
+		repo:              repo,
+		profiles:          profiles,
+		tools:             tools,
 	}
 }
 
-type groqRequest struct {
-	Messages []groqMessage `json:"messages"`
-	Model    string        `json:"model"`
-}
-
-type groqMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type groqResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-	Error *struct {
-		Message string `json:"message"`
-	} `json:"error,omitempty"`
-}
-
-func (s *Service) GetAdvice(question string) (string, error) {
-	if s.groqAPIKey == "" {
-		return "", apperrors.ErrGroqAPIUnavailable
-	}
-
-	reqBody := groqRequest{
-		Messages: []groqMessage{
-			{
-				Role:    "user",
-				Content: question,
-			},
-		},
-		Model: "llama-3.3-70b-versatile",
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+// GetAdvice отвечает на вопрос. Для авторизованного пользователя (userID > 0)
+// диалог сохраняется в новую сессию.
+func (s *Service) GetAdvice(ctx context.Context, userID int, question string) (*AdviceResponse, error) {
+	answer, tools, err := s.complete(ctx, []Message{{Role: roleUser, Content: question}})
 	if err != nil {
-		return "", apperrors.Wrap(err, "Ошибка сериализации запроса")
-	}
-
-	req, err := http.NewRequest("POST", "https://api.groq.com/openai/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", apperrors.Wrap(err, "Ошибка создания запроса")
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+s.groqAPIKey)
-	req.Header.Set("Content-Type", "application/json")
+	return &AdviceResponse{
+		Answer:    answer,
+		SessionID: s.saveNewSession(ctx, userID, sessionTitle(question), nil, question, tools, answer),
+	}, nil
+}
 
-	resp, err := s.httpClient.Do(req)
+// StreamAdvice — потоковый вариант GetAdvice: фрагменты ответа уходят в onDelta
+func (s *Service) StreamAdvice(ctx context.Context, userID int, question string, onDelta func(delta string) error) (*AdviceResponse, error) {
+	answer, tools, err := s.stream(ctx, []Message{{Role: roleUser, Content: question}}, onDelta)
 	if err != nil {
-		return "", apperrors.ErrGroqAPIUnavailable
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	return &AdviceResponse{
+		Answer:    answer,
+		SessionID: s.saveNewSession(ctx, userID, sessionTitle(question), nil, question, tools, answer),
+	}, nil
+}
+
+// complete отправляет диалог модели и возвращает текст ответа вместе
+// с вызовами инструментов, которые понадобились модели
+func (s *Service) complete(ctx context.Context, messages []Message) (string, []ToolInvocation, error) {
+	resp, tools, err := s.chatWithTools(ctx, messages, func(req ChatRequest) (*ChatResponse, error) {
+		return s.llm.Complete(ctx, req)
+	})
 	if err != nil {
-		return "", apperrors.Wrap(err, "Ошибка чтения ответа")
+		return "", nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", apperrors.NewWithDetails(503, "Groq API недоступен", fmt.Sprintf("status: %d, body: %s", resp.StatusCode, string(body)))
+	if resp.Content == "" {
+		return "Модель не вернула текст ответа.", tools, nil
 	}
 
-	var groqResp groqResponse
-	if err := json.Unmarshal(body, &groqResp); err != nil {
-		return "", apperrors.Wrap(err, "Ошибка десериализации ответа")
-	}
+	return resp.Content, tools, nil
+}
 
-	if groqResp.Error != nil {
-		return "", apperrors.NewWithDetails(503, "Ошибка от Groq", groqResp.Error.Message)
-	}
+// stream — потоковый вариант complete. Клиенту уходит только текст последнего раунда:
+// его же сохраняет история
+func (s *Service) stream(ctx context.Context, messages []Message, onDelta func(delta string) error) (string, []ToolInvocation, error) {
+	resp, tools, err := s.chatWithTools(ctx, messages, func(req ChatRequest) (*ChatResponse, error) {
+		if !req.allowsTools() {
+			return s.llm.Stream(ctx, req, onDelta)
+		}
 
-	if len(groqResp.Choices) == 0 {
-		return "", apperrors.New(503, "Модель не вернула текст ответа")
+		// Раунд может закончиться вызовом инструментов, и тогда его текст
+		// («сейчас посчитаю») не ответ. Копим его, пока это не станет ясно
+		var buffered strings.Builder
+		resp, err := s.llm.Stream(ctx, req, func(delta string) error {
+			buffered.WriteString(delta)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.ToolCalls) == 0 && buffered.Len() > 0 {
+			if err := onDelta(buffered.String()); err != nil {
+				return nil, err
+			}
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return "", nil, err
 	}
 
-	answer := groqResp.Choices[0].Message.Content
-	if answer == "" {
-		return "Модель не вернула текст ответа.", nil
+	if resp.Content == "" {
+		return "Модель не вернула текст ответа.", tools, nil
 	}
 
-	return answer, nil
+	return resp.Content, tools, nil
 }
 
 // AnalyzeFinances анализирует финансовую ситуацию пользователя
-func (s *Service) AnalyzeFinances(req AnalysisRequest) (AnalysisResponse, error) {
-	if s.groqAPIKey == "" {
-		return AnalysisResponse{}, apperrors.ErrGroqAPIUnavailable
-	}
-
+func (s *Service) AnalyzeFinances(ctx context.Context, userID int, req AnalysisRequest) (AnalysisResponse, error) {
 	// Формируем промпт с инструкциями для ИИ
 	additional := ""
 	if req.Additional != nil && *req.Additional != "" {
 		additional = "\n\nДополнительная информация: " + *req.Additional
 	}
 
+	// Суммы считаем сами: в арифметике модель ошибается
+	summary, err := s.calculateBudget(ctx, req)
+	if err != nil {
+		return AnalysisResponse{}, err
+	}
+
 	prompt := fmt.Sprintf(`Ты финансовый консультант для российского рынка. Пользователь из России. Проанализируй финансовую ситуацию и дай конкретные рекомендации с учетом реалий РФ.
 
 Данные пользователя (РФ):
@@ -137,12 +139,10 @@ func (s *Service) AnalyzeFinances(req AnalysisRequest) (AnalysisResponse, error)
 - Ежемесячные расходы: %s
 - Ежемесячные доходы: %s%s
 
-Задача:
-1. Извлеки из текста все суммы доходов и расходов (в рублях)
-2. Посчитай общий месячный доход
-3. Посчитай общие месячные расходы
-4. Вычисли разницу (профицит или дефицит)
-5. Дай конкретный финансовый совет с учетом российского рынка, законодательства РФ и экономической ситуации
+Проверенные расчёты (посчитаны программой, все суммы в рублях в месяц; не пересчитывай и не исправляй их):
+%s
+
+Задача: оцени финансовый риск и дай конкретный финансовый совет с учетом российского рынка, законодательства РФ и экономической ситуации. Опирайся на суммы из проверенных расчётов.
 
 Учитывай:
 - Российские банки, вклады (ставки ЦБ РФ)
@@ -150,122 +150,102 @@ func (s *Service) AnalyzeFinances(req AnalysisRequest) (AnalysisResponse, error)
 - Российские финансовые инструменты (брокерские счета, ИИС, ОФЗ)
 - Реалии российского рынка труда и социальной поддержки
 
-СТРОГО верни ответ в таком формате (используй эти маркеры ТОЧНО):
-
-===BALANCE===
-Доход: X руб/мес
-Расход: Y руб/мес
-Профицит/Дефицит: Z руб/мес
-
-===ADVICE===
-[здесь конкретные рекомендации для российского рынка с учетом ситуации пользователя]
+Верни ТОЛЬКО JSON-объект, без пояснений и markdown, строго по этой JSON Schema:
+%s
 
-Не добавляй ничего лишнего. Используй маркеры ===BALANCE=== и ===ADVICE=== ТОЧНО как указано.`, req.Status, req.Expenses, req.Income, additional)
+Правила:
+- riskLevel: low — есть профицит и запас, medium — баланс около нуля или заметная долговая нагрузка, high — дефицит или долги не обслуживаются
+- summary — 2-3 предложения о ситуации, recommendations — от 1 до 7 конкретных шагов для российского рынка`, req.Status, req.Expenses, req.Income, additional, describeBudget(summary), analysisSchema)
 
-	// Отправляем запрос в Groq
-	reqBody := groqRequest{
-		Messages: []groqMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		Model: "llama-3.3-70b-versatile",
+	report, err := s.completeAnalysis(ctx, prompt)
+	if err != nil {
+		return AnalysisResponse{}, err
 	}
 
-	jsonData, err := json.Marshal(reqBody)
+	result := analysisResponse(summary, report)
+	// В историю сохраняем данные пользователя и текстовый вид отчёта: по ним модель
+	// продолжит диалог. Промпт с требованием JSON в историю не попадает, иначе
+	// на уточняющие вопросы модель отвечала бы JSON-объектом
+	result.SessionID = s.saveNewSession(ctx, userID, "Анализ финансов", snapshotOf("analysis", req), analysisQuestion(req, summary), nil, result.Balance+"\n\n"+result.Advice)
+	return result, nil
+}
+
+// GetStructuredAdvice обрабатывает структурированный запрос с конвертацией валют
+func (s *Service) GetStructuredAdvice(ctx context.Context, userID int, req StructuredAdviceRequest) (*StructuredAdviceResponse, error) {
+	question, result, err := s.prepareStructuredAdvice(ctx, req)
 	if err != nil {
-		return AnalysisResponse{}, apperrors.Wrap(err, "Ошибка сериализации запроса")
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", "https://api.groq.com/openai/v1/chat/completions", bytes.NewBuffer(jsonData))
+	// Отправляем в модель
+	answer, tools, err := s.complete(ctx, []Message{{Role: roleUser, Content: question}})
 	if err != nil {
-		return AnalysisResponse{}, apperrors.Wrap(err, "Ошибка создания запроса")
+		return nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+s.groqAPIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
+	result.Answer = answer
+	result.SessionID = s.saveNewSession(ctx, userID, "Разбор бюджета", structuredSnapshot(req, result), question, tools, answer)
+	return result, nil
+}
 
-	resp, err := s.httpClient.Do(httpReq)
+// StreamStructuredAdvice — потоковый вариант GetStructuredAdvice
+func (s *Service) StreamStructuredAdvice(ctx context.Context, userID int, req StructuredAdviceRequest, onDelta func(delta string) error) (*StructuredAdviceResponse, error) {
+	question, result, err := s.prepareStructuredAdvice(ctx, req)
 	if err != nil {
-		return AnalysisResponse{}, apperrors.ErrGroqAPIUnavailable
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	answer, tools, err := s.stream(ctx, []Message{{Role: roleUser, Content: question}}, onDelta)
 	if err != nil {
-		return AnalysisResponse{}, apperrors.Wrap(err, "Ошибка чтения ответа")
+		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return AnalysisResponse{}, apperrors.NewWithDetails(503, "Groq API недоступен", fmt.Sprintf("status: %d", resp.StatusCode))
-	}
+	result.Answer = answer
+	result.SessionID = s.saveNewSession(ctx, userID, "Разбор бюджета", structuredSnapshot(req, result), question, tools, answer)
+	return result, nil
+}
 
-	var groqResp groqResponse
-	if err := json.Unmarshal(body, &groqResp); err != nil {
-		return AnalysisResponse{}, apperrors.Wrap(err, "Ошибка десериализации ответа")
+// FillFromProfile подставляет данные из сохранённого профиля, если в запросе
+// не указаны доходы или расходы. Для анонимных запросов ничего не делает.
+func (s *Service) FillFromProfile(ctx context.Context, userID int, req *StructuredAdviceRequest) error {
+	if userID == 0 || (len(req.IncomeSources) > 0 && len(req.ExpenseSources) > 0) {
+		return nil
 	}
 
-	if groqResp.Error != nil {
-		return AnalysisResponse{}, apperrors.NewWithDetails(503, "Ошибка от Groq", groqResp.Error.Message)
+	p, err := s.profiles.GetProfile(ctx, userID)
+	if err != nil {
+		return err
 	}
-
-	if len(groqResp.Choices) == 0 {
-		return AnalysisResponse{}, apperrors.New(503, "Модель не вернула текст ответа")
+	if p.UpdatedAt == nil {
+		return nil
 	}
 
-	answer := groqResp.Choices[0].Message.Content
-	if answer == "" {
-		return AnalysisResponse{}, apperrors.New(503, "Модель вернула пустой ответ")
+	if len(req.IncomeSources) == 0 && p.MonthlyIncome > 0 {
+		req.IncomeSources = []FinanceSource{{ID: "profile-income", Type: profileSourceType, Amount: p.MonthlyIncome, Currency: p.Currency}}
 	}
-
-	// Парсим ответ (ищем БАЛАНС: и СОВЕТ:)
-	return parseAnalysisResponse(answer), nil
-}
-
-// parseAnalysisResponse извлекает баланс и совет из ответа ИИ
-func parseAnalysisResponse(text string) AnalysisResponse {
-	// Ищем маркеры с помощью strings.Split
-	balanceMarker := "===BALANCE==="
-	adviceMarker := "===ADVICE==="
-
-	balance := ""
-	advice := ""
-
-	// Разбиваем текст по маркерам
-	if strings.Contains(text, balanceMarker) && strings.Contains(text, adviceMarker) {
-		parts := strings.Split(text, balanceMarker)
-		if len(parts) > 1 {
-			afterBalance := parts[1]
-			adviceParts := strings.Split(afterBalance, adviceMarker)
-			
-			if len(adviceParts) > 1 {
-				balance = strings.TrimSpace(adviceParts[0])
-				advice = strings.TrimSpace(adviceParts[1])
-			}
-		}
+	if len(req.ExpenseSources) == 0 && p.MonthlyExpenses > 0 {
+		req.ExpenseSources = []FinanceSource{{ID: "profile-expenses", Type: profileSourceType, Amount: p.MonthlyExpenses, Currency: p.Currency}}
 	}
 
-	// Если парсинг не сработал, возвращаем весь текст как совет
-	if balance == "" && advice == "" {
-		return AnalysisResponse{
-			Balance: "Данные недоступны",
-			Advice:  strings.TrimSpace(text),
+	if req.AdditionalInfo == "" {
+		var extra []string
+		if p.DebtAmount > 0 {
+			extra = append(extra, fmt.Sprintf("общая сумма долгов %.2f %s", p.DebtAmount, p.Currency))
+		}
+		if p.SavingsGoal > 0 {
+			extra = append(extra, fmt.Sprintf("цель накоплений %.2f %s", p.SavingsGoal, p.Currency))
+		}
+		if len(extra) > 0 {
+			req.AdditionalInfo = "Из профиля: " + strings.Join(extra, ", ")
 		}
 	}
 
-	return AnalysisResponse{
-		Balance: balance,
-		Advice:  advice,
-	}
+	return nil
 }
 
-// GetStructuredAdvice обрабатывает структурированный запрос с конвертацией валют
-func (s *Service) GetStructuredAdvice(ctx context.Context, req StructuredAdviceRequest) (*StructuredAdviceResponse, error) {
-	if s.groqAPIKey == "" {
-		return nil, apperrors.ErrGroqAPIUnavailable
-	}
-
+// prepareStructuredAdvice конвертирует суммы в рубли и собирает промпт.
+// Возвращает промпт и ответ с заполненными итогами (без текста совета).
+func (s *Service) prepareStructuredAdvice(ctx context.Context, req StructuredAdviceRequest) (string, *StructuredAdviceResponse, error) {
 	// Конвертируем все доходы в рубли
 	totalIncomeRUB := 0.0
 	incomeDetails := []string{}
@@ -276,7 +256,7 @@ func (s *Service) GetStructuredAdvice(ctx context.Context, req StructuredAdviceR
 		
 		amountInRUB, err := s.currencyConverter.ConvertToRUB(ctx, source.Amount, source.Currency)
 		if err != nil {
-			return nil, apperrors.Wrap(err, "Ошибка конвертации валюты")
+			return "", nil, conversionError(err)
 		}
 		
 		totalIncomeRUB += amountInRUB
@@ -294,7 +274,7 @@ func (s *Service) GetStructuredAdvice(ctx context.Context, req StructuredAdviceR
 		
 		amountInRUB, err := s.currencyConverter.ConvertToRUB(ctx, source.Amount, source.Currency)
 		if err != nil {
-			return nil, apperrors.Wrap(err, "Ошибка конвертации валюты")
+			return "", nil, conversionError(err)
 		}
 		
 		totalExpensesRUB += amountInRUB
@@ -316,20 +296,22 @@ func (s *Service) GetStructuredAdvice(ctx context.Context, req StructuredAdviceR
 		req.AdditionalInfo,
 	)
 
-	// Отправляем в Groq
-	answer, err := s.GetAdvice(question)
-	if err != nil {
-		return nil, err
-	}
-
-	return &StructuredAdviceResponse{
-		Answer:           answer,
+	return question, &StructuredAdviceResponse{
 		TotalIncomeRUB:   totalIncomeRUB,
 		TotalExpensesRUB: totalExpensesRUB,
 		BalanceRUB:       balance,
 	}, nil
 }
 
+// conversionError: отмену и истёкший дедлайн отдаём как есть, чтобы обработчик
+// ответил 504, а не ошибкой конвертации
+func conversionError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return apperrors.Wrap(err, "Ошибка конвертации валюты")
+}
+
 // buildFinancePrompt создает промпт для AI на основе структурированных данных
 func buildFinancePrompt(
 	totalIncome, totalExpenses, balance float64,
@@ -397,9 +379,13 @@ func buildFinancePrompt(
 	return prompt.String()
 }
 
+// profileSourceType — тип источника, подставленного из профиля
+const profileSourceType = "profile"
+
 // Вспомогательные функции для получения меток
 func getIncomeTypeLabel(t string) string {
 	labels := map[string]string{
+		"profile":        "📋 Доход из профиля",
 		"salary":         "💼 Зарплата",
 		"pension":        "👴 Пенсия",
 		"bonus":          "🎁 Премии",
@@ -417,6 +403,7 @@ func getIncomeTypeLabel(t string) string {
 
 func getExpenseTypeLabel(t string) string {
 	labels := map[string]string{
+		"profile":   "📋 Расходы из профиля",
 		"food":      "🍔 Еда",
 		"utilities": "💡 Коммуналка",
 		"credit":    "💳 Кредиты",
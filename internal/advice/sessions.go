@@ -0,0 +1,341 @@
+package advice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// Роли сообщений в advice_messages
+const (
+	roleUser      = "user"
+	roleAssistant = "assistant"
+	// roleTool — вызов калькулятора моделью; модели при уточнениях не пересылается
+	roleTool = "tool"
+)
+
+const (
+	// maxSessionTitle — длина заголовка сессии в символах
+	maxSessionTitle = 80
+	// maxHistoryMessages ограничивает историю, отправляемую модели при уточнении
+	maxHistoryMessages = 20
+
+	defaultSessionsPageSize = 20
+	maxSessionsPageSize     = 100
+)
+
+// Форматы экспорта сессии
+const (
+	ExportFormatMarkdown = "markdown"
+	ExportFormatJSON     = "json"
+)
+
+// ListSessions возвращает страницу сессий пользователя
+func (s *Service) ListSessions(ctx context.Context, userID int, cursor string, limit int) (*SessionListResponse, error) {
+	after := 0
+	if cursor != "" {
+		var err error
+		after, err = strconv.Atoi(cursor)
+		if err != nil || after <= 0 {
+			return nil, apperrors.NewWithDetails(400, "Неверный курсор", "cursor must be a value from nextCursor")
+		}
+	}
+
+	if limit <= 0 {
+		limit = defaultSessionsPageSize
+	}
+	if limit > maxSessionsPageSize {
+		limit = maxSessionsPageSize
+	}
+
+	// Берём на одну запись больше, чтобы понять, есть ли следующая страница
+	sessions, err := s.repo.ListSessions(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки сессий")
+	}
+
+	resp := &SessionListResponse{Sessions: sessions}
+	if len(sessions) > limit {
+		resp.Sessions = sessions[:limit]
+		resp.NextCursor = strconv.Itoa(sessions[limit-1].ID)
+	}
+
+	return resp, nil
+}
+
+// GetSession возвращает сессию с сообщениями и исходными данными
+func (s *Service) GetSession(ctx context.Context, userID, sessionID int) (*SessionDetails, error) {
+	session, err := s.repo.GetSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, sessionError(err, "Ошибка загрузки сессии")
+	}
+
+	messages, err := s.repo.GetMessages(ctx, sessionID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки истории")
+	}
+
+	return &SessionDetails{Session: *session, Messages: messages}, nil
+}
+
+func (s *Service) RenameSession(ctx context.Context, userID, sessionID int, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return apperrors.NewWithDetails(400, "Название не может быть пустым", "title is required")
+	}
+	if utf8.RuneCountInString(title) > 255 {
+		return apperrors.NewWithDetails(400, "Слишком длинное название", "title must be at most 255 characters")
+	}
+
+	if err := s.repo.RenameSession(ctx, sessionID, userID, title); err != nil {
+		return sessionError(err, "Ошибка переименования сессии")
+	}
+	return nil
+}
+
+func (s *Service) DeleteSession(ctx context.Context, userID, sessionID int) error {
+	if err := s.repo.DeleteSession(ctx, sessionID, userID); err != nil {
+		return sessionError(err, "Ошибка удаления сессии")
+	}
+	return nil
+}
+
+// ExportSession выгружает сессию в Markdown или JSON
+func (s *Service) ExportSession(ctx context.Context, userID, sessionID int, format string) ([]byte, error) {
+	details, err := s.GetSession(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case ExportFormatJSON:
+		data, err := json.MarshalIndent(details, "", "  ")
+		if err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка экспорта сессии")
+		}
+		return data, nil
+	case ExportFormatMarkdown:
+		return renderSessionMarkdown(details), nil
+	default:
+		return nil, apperrors.NewWithDetails(400, "Неизвестный формат экспорта", "format must be markdown or json")
+	}
+}
+
+// renderSessionMarkdown превращает сессию в читаемый Markdown-документ
+func renderSessionMarkdown(details *SessionDetails) []byte {
+	var md strings.Builder
+
+	title := details.Title
+	if title == "" {
+		title = "Консультация"
+	}
+	md.WriteString(fmt.Sprintf("# %s\n\n", title))
+	md.WriteString(fmt.Sprintf("_%s_\n\n", details.CreatedAt.Format("02.01.2006 15:04")))
+
+	if len(details.ContextSnapshot) > 0 {
+		snapshot := details.ContextSnapshot
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, snapshot, "", "  "); err == nil {
+			snapshot = pretty.Bytes()
+		}
+		md.WriteString("## Исходные данные\n\n```json\n")
+		md.Write(snapshot)
+		md.WriteString("\n```\n\n")
+	}
+
+	md.WriteString("## Переписка\n\n")
+	for _, msg := range details.Messages {
+		if msg.Role == roleTool {
+			md.WriteString("_Расчёт:_\n\n```json\n")
+			md.WriteString(strings.TrimSpace(msg.Content))
+			md.WriteString("\n```\n\n")
+			continue
+		}
+
+		author := "Вы"
+		if msg.Role == roleAssistant {
+			author = "Консультант"
+		}
+		md.WriteString(fmt.Sprintf("### %s — %s\n\n", author, msg.CreatedAt.Format("02.01.2006 15:04")))
+		md.WriteString(strings.TrimSpace(msg.Content))
+		md.WriteString("\n\n")
+	}
+
+	return []byte(md.String())
+}
+
+// sessionError переводит ошибки репозитория в ошибки API
+func sessionError(err error, message string) error {
+	if errors.Is(err, ErrSessionNotFound) {
+		return apperrors.ErrNotFound
+	}
+	return apperrors.Wrap(err, message)
+}
+
+// ContinueSession задаёт уточняющий вопрос с учётом всей предыдущей переписки
+func (s *Service) ContinueSession(ctx context.Context, userID, sessionID int, question string) (*AdviceResponse, error) {
+	messages, err := s.followUpMessages(ctx, userID, sessionID, question)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, tools, err := s.complete(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	s.saveExchange(ctx, sessionID, question, tools, answer)
+	return &AdviceResponse{Answer: answer, SessionID: sessionID}, nil
+}
+
+// StreamContinueSession — потоковый вариант ContinueSession
+func (s *Service) StreamContinueSession(ctx context.Context, userID, sessionID int, question string, onDelta func(delta string) error) (*AdviceResponse, error) {
+	messages, err := s.followUpMessages(ctx, userID, sessionID, question)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, tools, err := s.stream(ctx, messages, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	s.saveExchange(ctx, sessionID, question, tools, answer)
+	return &AdviceResponse{Answer: answer, SessionID: sessionID}, nil
+}
+
+// followUpMessages загружает историю сессии и добавляет к ней новый вопрос
+func (s *Service) followUpMessages(ctx context.Context, userID, sessionID int, question string) ([]Message, error) {
+	if _, err := s.repo.GetSession(ctx, sessionID, userID); err != nil {
+		return nil, sessionError(err, "Ошибка загрузки сессии")
+	}
+
+	history, err := s.repo.GetMessages(ctx, sessionID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки истории")
+	}
+
+	// Вызовы инструментов хранятся для пользователя: без исходных tool_calls
+	// модель их не примет, а итог расчёта уже есть в ответе
+	dialog := history[:0:0]
+	for _, msg := range history {
+		if msg.Role != roleTool {
+			dialog = append(dialog, msg)
+		}
+	}
+
+	messages := make([]Message, 0, len(dialog)+1)
+	for i, msg := range trimHistory(dialog) {
+		content := msg.Content
+		if i == 0 && msg.Role == roleUser {
+			content = stripAnalysisInstructions(content)
+		}
+		messages = append(messages, Message{Role: msg.Role, Content: content})
+	}
+	return append(messages, Message{Role: roleUser, Content: question}), nil
+}
+
+// trimHistory оставляет первое сообщение (в нём исходные финансовые данные)
+// и последние сообщения переписки, чтобы не выйти за контекст модели
+func trimHistory(history []SessionMessage) []SessionMessage {
+	if len(history) <= maxHistoryMessages {
+		return history
+	}
+	trimmed := []SessionMessage{history[0]}
+	return append(trimmed, history[len(history)-maxHistoryMessages+1:]...)
+}
+
+// saveTimeout — сколько ждём БД при сохранении уже полученного ответа
+const saveTimeout = 5 * time.Second
+
+// saveNewSession сохраняет первый обмен репликами в новую сессию и возвращает её id.
+// Для анонимных запросов и при ошибках БД возвращает 0: совет уже получен,
+// и терять его из-за истории не стоит.
+func (s *Service) saveNewSession(ctx context.Context, userID int, title string, snapshot json.RawMessage, question string, tools []ToolInvocation, answer string) int {
+	if userID == 0 {
+		return 0
+	}
+
+	ctx, cancel := saveContext(ctx)
+	defer cancel()
+
+	session, err := s.repo.CreateSession(ctx, userID, title, snapshot)
+	if err != nil {
+		log.Printf("Failed to save advice session: %v", err)
+		return 0
+	}
+
+	s.saveExchange(ctx, session.ID, question, tools, answer)
+	return session.ID
+}
+
+// saveExchange записывает вопрос, вызовы инструментов и ответ в сессию
+func (s *Service) saveExchange(ctx context.Context, sessionID int, question string, tools []ToolInvocation, answer string) {
+	ctx, cancel := saveContext(ctx)
+	defer cancel()
+
+	if err := s.repo.AddMessage(ctx, sessionID, roleUser, question); err != nil {
+		log.Printf("Failed to save advice message: %v", err)
+		return
+	}
+	for _, tool := range tools {
+		content, err := json.Marshal(tool)
+		if err != nil {
+			log.Printf("Failed to encode tool invocation: %v", err)
+			continue
+		}
+		if err := s.repo.AddMessage(ctx, sessionID, roleTool, string(content)); err != nil {
+			log.Printf("Failed to save advice message: %v", err)
+		}
+	}
+	if err := s.repo.AddMessage(ctx, sessionID, roleAssistant, answer); err != nil {
+		log.Printf("Failed to save advice message: %v", err)
+	}
+}
+
+// saveContext отвязывает сохранение от отмены и дедлайна запроса: ответ модели
+// уже получен и должен попасть в историю, даже если клиент успел отключиться
+func saveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+}
+
+// sessionTitle делает заголовок сессии из первого вопроса
+func sessionTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if utf8.RuneCountInString(title) <= maxSessionTitle {
+		return title
+	}
+	runes := []rune(title)
+	return string(runes[:maxSessionTitle]) + "…"
+}
+
+// snapshotOf сериализует исходные данные запроса для context_snapshot
+func snapshotOf(kind string, data interface{}) json.RawMessage {
+	raw, err := json.Marshal(map[string]interface{}{
+		"type": kind,
+		"data": data,
+	})
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// structuredSnapshot сохраняет входные данные вместе с посчитанными итогами
+func structuredSnapshot(req StructuredAdviceRequest, result *StructuredAdviceResponse) json.RawMessage {
+	return snapshotOf("structured", map[string]interface{}{
+		"request":          req,
+		"totalIncomeRUB":   result.TotalIncomeRUB,
+		"totalExpensesRUB": result.TotalExpensesRUB,
+		"balanceRUB":       result.BalanceRUB,
+	})
+}
@@ -0,0 +1,46 @@
+package advice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sseWriter пишет события Server-Sent Events в ответ echo
+type sseWriter struct {
+	res *echo.Response
+}
+
+// newSSEWriter отправляет заголовки потока. После этого вернуть
+// обычный JSON с ошибкой уже нельзя — только событие "error".
+func newSSEWriter(c echo.Context) *sseWriter {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // отключаем буферизацию в nginx
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	return &sseWriter{res: res}
+}
+
+func (w *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+// wantsEventStream проверяет, запросил ли клиент потоковый ответ
+func wantsEventStream(c echo.Context) bool {
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream")
+}
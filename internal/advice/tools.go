@@ -0,0 +1,286 @@
+package advice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	// maxToolRounds — сколько раз за ответ модель может обратиться к инструментам;
+	// после этого она обязана ответить текстом
+	maxToolRounds = 4
+	// maxToolCallsPerRound — лишние вызовы в одном ответе модели отбрасываются
+	maxToolCallsPerRound = 8
+
+	// toolChoiceNone запрещает модели вызывать инструменты
+	toolChoiceNone = "none"
+)
+
+// Имена инструментов
+const (
+	toolConvertCurrency  = "convert_to_rub"
+	toolLoanAmortization = "loan_amortization"
+	toolCompoundInterest = "compound_interest"
+	toolDepositAfterTax  = "deposit_after_tax"
+	toolDebtPayoff       = "debt_payoff"
+)
+
+// toolDefinitions описывают инструменты для модели в формате OpenAI tools
+var toolDefinitions = []Tool{
+	functionTool(toolConvertCurrency,
+		"Переводит сумму в рубли по текущему курсу.",
+		`{"type": "object", "required": ["amount", "currency"], "properties": {
+			"amount": {"type": "number", "minimum": 0},
+			"currency": {"type": "string", "enum": ["RUB", "USD", "EUR", "KZT", "AZN"]}
+		}}`),
+	functionTool(toolLoanAmortization,
+		"Аннуитетный кредит: ежемесячный платёж, переплата и остаток долга по годам.",
+		`{"type": "object", "required": ["principal", "annualRatePercent", "months"], "properties": {
+			"principal": {"type": "number", "description": "сумма кредита, ₽"},
+			"annualRatePercent": {"type": "number", "description": "годовая ставка, %"},
+			"months": {"type": "integer", "minimum": 1, "maximum": 600}
+		}}`),
+	functionTool(toolCompoundInterest,
+		"Накопления со сложным процентом и ежемесячными пополнениями: итоговая сумма и остаток по годам.",
+		`{"type": "object", "required": ["initial", "annualRatePercent", "years"], "properties": {
+			"initial": {"type": "number", "description": "стартовая сумма, ₽"},
+			"monthlyContribution": {"type": "number", "description": "пополнение в конце каждого месяца, ₽"},
+			"annualRatePercent": {"type": "number"},
+			"years": {"type": "integer", "minimum": 1, "maximum": 50},
+			"capitalization": {"type": "string", "enum": ["monthly", "quarterly", "yearly"]}
+		}}`),
+	functionTool(toolDepositAfterTax,
+		"Доход по банковскому вкладу в РФ после НДФЛ с учётом необлагаемого лимита (1 млн ₽ × максимальная ключевая ставка ЦБ за год).",
+		`{"type": "object", "required": ["amount", "annualRatePercent", "months", "keyRatePercent"], "properties": {
+			"amount": {"type": "number", "description": "сумма вклада, ₽"},
+			"annualRatePercent": {"type": "number", "description": "ставка по вкладу, %"},
+			"months": {"type": "integer", "minimum": 1, "maximum": 600},
+			"capitalization": {"type": "boolean", "description": "ежемесячная капитализация процентов"},
+			"keyRatePercent": {"type": "number", "description": "максимальная ключевая ставка ЦБ РФ в году выплаты, %"}
+		}}`),
+	functionTool(toolDebtPayoff,
+		"План погашения нескольких долгов при фиксированном ежемесячном бюджете: срок, переплата и порядок закрытия.",
+		`{"type": "object", "required": ["debts", "monthlyBudget"], "properties": {
+			"debts": {"type": "array", "minItems": 1, "maxItems": 20, "items": {
+				"type": "object", "required": ["name", "balance", "annualRatePercent", "minPayment"], "properties": {
+					"name": {"type": "string"},
+					"balance": {"type": "number"},
+					"annualRatePercent": {"type": "number"},
+					"minPayment": {"type": "number"}
+				}}},
+			"monthlyBudget": {"type": "number", "description": "сколько всего в месяц идёт на долги, ₽"},
+			"strategy": {"type": "string", "enum": ["avalanche", "snowball"], "description": "avalanche — сначала дорогие, snowball — сначала маленькие"}
+		}}`),
+}
+
+func knownTool(name string) bool {
+	for _, tool := range toolDefinitions {
+		if tool.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func functionTool(name, description, parameters string) Tool {
+	return Tool{
+		Type:     "function",
+		Function: ToolFunction{Name: name, Description: description, Parameters: json.RawMessage(parameters)},
+	}
+}
+
+// Toolbox выполняет финансовые расчёты по запросу модели, чтобы она не считала в уме
+type Toolbox struct {
+	currencyConverter CurrencyConverter
+}
+
+func NewToolbox(currencyConverter CurrencyConverter) *Toolbox {
+	return &Toolbox{currencyConverter: currencyConverter}
+}
+
+// ToolInvocation — вызов инструмента; в таком виде он пишется в advice_messages с ролью "tool"
+type ToolInvocation struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Result    any             `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Call выполняет вызов. Ошибка расчёта не прерывает ответ: она уходит модели
+// как результат, и модель может поправить аргументы
+func (t *Toolbox) Call(ctx context.Context, call ToolCall) ToolInvocation {
+	invocation := ToolInvocation{Tool: call.Function.Name, Arguments: rawArguments(call.Function.Arguments)}
+
+	// Имя пришло от модели: неизвестные не плодят отдельные счётчики
+	metric := "tools.unknown"
+	if knownTool(call.Function.Name) {
+		metric = "tools." + call.Function.Name
+	}
+
+	result, err := t.run(ctx, call.Function.Name, []byte(call.Function.Arguments))
+	if err != nil {
+		// Подробности отмены модели не нужны: ответа она уже не получит
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			invocation.Error = "request cancelled"
+		} else {
+			invocation.Error = err.Error()
+		}
+		llmMetrics.Add(metric+".errors", 1)
+		return invocation
+	}
+
+	llmMetrics.Add(metric+".calls", 1)
+	invocation.Result = result
+	return invocation
+}
+
+func (t *Toolbox) run(ctx context.Context, name string, args []byte) (any, error) {
+	switch name {
+	case toolConvertCurrency:
+		var in struct {
+			Amount   float64 `json:"amount"`
+			Currency string  `json:"currency"`
+		}
+		if err := decodeArguments(args, &in); err != nil {
+			return nil, err
+		}
+		if in.Amount < 0 {
+			return nil, errors.New("amount must not be negative")
+		}
+		rub, err := t.currencyConverter.ConvertToRUB(ctx, in.Amount, strings.ToUpper(in.Currency))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"amountRUB": roundKopecks(rub)}, nil
+
+	case toolLoanAmortization:
+		var in struct {
+			Principal  float64 `json:"principal"`
+			AnnualRate float64 `json:"annualRatePercent"`
+			Months     int     `json:"months"`
+		}
+		if err := decodeArguments(args, &in); err != nil {
+			return nil, err
+		}
+		return loanAmortization(in.Principal, in.AnnualRate, in.Months)
+
+	case toolCompoundInterest:
+		var in struct {
+			Initial             float64 `json:"initial"`
+			MonthlyContribution float64 `json:"monthlyContribution"`
+			AnnualRate          float64 `json:"annualRatePercent"`
+			Years               int     `json:"years"`
+			Capitalization      string  `json:"capitalization"`
+		}
+		if err := decodeArguments(args, &in); err != nil {
+			return nil, err
+		}
+		return compoundInterest(in.Initial, in.MonthlyContribution, in.AnnualRate, in.Years, in.Capitalization)
+
+	case toolDepositAfterTax:
+		var in struct {
+			Amount         float64 `json:"amount"`
+			AnnualRate     float64 `json:"annualRatePercent"`
+			Months         int     `json:"months"`
+			Capitalization bool    `json:"capitalization"`
+			KeyRate        float64 `json:"keyRatePercent"`
+		}
+		if err := decodeArguments(args, &in); err != nil {
+			return nil, err
+		}
+		return depositAfterTax(in.Amount, in.AnnualRate, in.Months, in.Capitalization, in.KeyRate)
+
+	case toolDebtPayoff:
+		var in struct {
+			Debts         []debtItem `json:"debts"`
+			MonthlyBudget float64    `json:"monthlyBudget"`
+			Strategy      string     `json:"strategy"`
+		}
+		if err := decodeArguments(args, &in); err != nil {
+			return nil, err
+		}
+		return debtPayoff(in.Debts, in.MonthlyBudget, in.Strategy)
+
+	default:
+		return nil, fmt.Errorf("unknown tool %q", name)
+	}
+}
+
+func decodeArguments(args []byte, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// rawArguments сохраняет аргументы как JSON, а невалидную строку — как строку
+func rawArguments(args string) json.RawMessage {
+	if json.Valid([]byte(args)) {
+		return json.RawMessage(args)
+	}
+	quoted, _ := json.Marshal(args)
+	return quoted
+}
+
+// resultMessage — ответ инструмента для модели
+func (inv ToolInvocation) resultMessage(callID string) Message {
+	var content []byte
+	if inv.Error != "" {
+		content, _ = json.Marshal(map[string]string{"error": inv.Error})
+	} else if data, err := json.Marshal(inv.Result); err == nil {
+		content = data
+	} else {
+		content, _ = json.Marshal(map[string]string{"error": "failed to encode result"})
+	}
+	return Message{Role: roleTool, Content: string(content), ToolCallID: callID}
+}
+
+// allowsTools: модель может ответить вызовом инструментов вместо текста
+func (req ChatRequest) allowsTools() bool {
+	return req.Tools != nil && req.ToolChoice != toolChoiceNone
+}
+
+// chatWithTools ведёт диалог с моделью, выполняя запрошенные ею расчёты, пока она
+// не ответит текстом. Без Toolbox это один обычный запрос
+func (s *Service) chatWithTools(ctx context.Context, messages []Message, send func(ChatRequest) (*ChatResponse, error)) (*ChatResponse, []ToolInvocation, error) {
+	messages = append([]Message(nil), messages...)
+
+	var invocations []ToolInvocation
+	for round := 0; ; round++ {
+		req := ChatRequest{Messages: messages}
+		if s.tools != nil {
+			req.Tools = toolDefinitions
+			// Инструменты остаются в запросе: без них API не примет историю с их вызовами
+			if round >= maxToolRounds {
+				req.ToolChoice = toolChoiceNone
+			}
+		}
+
+		resp, err := send(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(resp.ToolCalls) == 0 || !req.allowsTools() {
+			return resp, invocations, nil
+		}
+
+		calls := resp.ToolCalls
+		if len(calls) > maxToolCallsPerRound {
+			log.Printf("LLM requested %d tool calls, keeping %d", len(calls), maxToolCallsPerRound)
+			calls = calls[:maxToolCallsPerRound]
+		}
+		messages = append(messages, Message{Role: roleAssistant, Content: resp.Content, ToolCalls: calls})
+		for _, call := range calls {
+			invocation := s.tools.Call(ctx, call)
+			invocations = append(invocations, invocation)
+			messages = append(messages, invocation.resultMessage(call.ID))
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
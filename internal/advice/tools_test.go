@@ -0,0 +1,52 @@
+package advice
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStreamAdviceSendsOnlyFinalRound(t *testing.T) {
+	provider := &scriptedProvider{FakeProvider: NewFakeProvider(), toolRounds: 2}
+	service := NewService(provider, nil, nil, nil, NewToolbox(nil))
+
+	var streamed strings.Builder
+	result, err := service.StreamAdvice(context.Background(), 0, "Какой платёж по кредиту 1 млн на год под 12%?", func(delta string) error {
+		streamed.WriteString(delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamAdvice: %v", err)
+	}
+
+	if provider.calls != 3 {
+		t.Fatalf("provider called %d times, want 2 tool rounds and the answer", provider.calls)
+	}
+	if strings.Contains(streamed.String(), toolRoundText) {
+		t.Fatalf("text of a tool round reached the client: %q", streamed.String())
+	}
+	if streamed.String() != result.Answer {
+		t.Fatalf("streamed %q, but the answer is %q", streamed.String(), result.Answer)
+	}
+}
+
+func TestStreamAdviceForcedAnswerIsStreamed(t *testing.T) {
+	// Модель не перестаёт звать инструменты: последний раунд идёт с tool_choice=none
+	provider := &scriptedProvider{FakeProvider: NewFakeProvider(), toolRounds: maxToolRounds + 1}
+	service := NewService(provider, nil, nil, nil, NewToolbox(nil))
+
+	deltas := 0
+	result, err := service.StreamAdvice(context.Background(), 0, "Посчитай ипотеку", func(delta string) error {
+		deltas++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamAdvice: %v", err)
+	}
+	if provider.calls != maxToolRounds+1 {
+		t.Fatalf("provider called %d times, want %d", provider.calls, maxToolRounds+1)
+	}
+	if deltas < 2 || strings.Contains(result.Answer, toolRoundText) {
+		t.Fatalf("forced answer %q came in %d deltas, want it streamed word by word", result.Answer, deltas)
+	}
+}
@@ -0,0 +1,22 @@
+package audit
+
+import "time"
+
+// Entry — запись журнала аудита
+type Entry struct {
+	ID           int            `json:"id"`
+	ActorID      int            `json:"actorId,omitempty"` // 0 — действие системы
+	Action       string         `json:"action"`
+	TargetUserID int            `json:"targetUserId,omitempty"`
+	IP           string         `json:"ip,omitempty"`
+	Details      map[string]any `json:"details,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+// Filter ограничивает выборку журнала
+type Filter struct {
+	TargetUserID int    // 0 — по всем пользователям
+	Action       string // пусто — все действия
+	Cursor       int    // id записи, после которой продолжать
+	Limit        int
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Repository пишет и читает журнал аудита (таблица audit_log)
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Record добавляет запись в журнал
+func (r *Repository) Record(ctx context.Context, entry Entry) error {
+	return record(ctx, r.db, entry)
+}
+
+// RecordTx добавляет запись в транзакции самого действия: если запись
+// не удалась, действие откатывается и не остаётся без следа в журнале
+func (r *Repository) RecordTx(ctx context.Context, tx *sql.Tx, entry Entry) error {
+	return record(ctx, tx, entry)
+}
+
+// execer — *sql.DB или *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func record(ctx context.Context, db execer, entry Entry) error {
+	var details []byte
+	if len(entry.Details) > 0 {
+		var err error
+		details, err = json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO audit_log (actor_id, action, target_user_id, ip, details)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		nullableID(entry.ActorID), entry.Action, nullableID(entry.TargetUserID), entry.IP, details,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// List возвращает записи журнала, новые первыми
+func (r *Repository) List(ctx context.Context, filter Filter) ([]Entry, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, COALESCE(actor_id, 0), action, COALESCE(target_user_id, 0),
+		        COALESCE(ip, ''), details, created_at
+		 FROM audit_log
+		 WHERE ($1 = 0 OR target_user_id = $1)
+		   AND ($2 = '' OR action = $2)
+		   AND ($3 = 0 OR id < $3)
+		 ORDER BY id DESC
+		 LIMIT $4`,
+		filter.TargetUserID, filter.Action, filter.Cursor, filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var entry Entry
+		var details []byte
+		if err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetUserID,
+			&entry.IP, &details, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &entry.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode audit details: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func nullableID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Действия пользователя с учётными данными в журнале аудита
+const (
+	ActionPasswordChange     = "auth.password.change"
+	ActionEmailChangeRequest = "auth.email.change_request"
+	ActionEmailChange        = "auth.email.change"
+)
+
+const (
+	emailChangeTTL = 24 * time.Hour
+
+	// Не больше emailChangeLimit писем о смене адреса за emailChangeWindow
+	emailChangeLimit  = 3
+	emailChangeWindow = time.Hour
+)
+
+var (
+	errNoPassword = apperrors.NewWithDetails(http.StatusBadRequest, "У аккаунта нет пароля",
+		"Задайте пароль через восстановление пароля и повторите действие")
+	errInvalidEmail = apperrors.New(http.StatusBadRequest, "Неверный формат email")
+	errSameEmail    = apperrors.New(http.StatusBadRequest, "Это ваш текущий email")
+)
+
+// ConfirmPassword повторно проверяет пароль перед опасным действием с аккаунтом.
+// Неудачи учитываются так же, как при входе, чтобы украденный токен
+// не позволял подбирать пароль
+func (s *Service) ConfirmPassword(ctx context.Context, userID int, email, password string) error {
+	if password == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	email = normalizeEmail(email)
+	if err := s.checkLoginLock(ctx, email, ""); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.repo.GetPasswordHash(ctx, userID)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки пароля")
+	}
+	if passwordHash == "" {
+		// Аккаунт создан через социальный вход
+		return errNoPassword
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+		if err := s.recordLoginFailure(ctx, email, ""); err != nil {
+			return err
+		}
+		return apperrors.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// ForgetUser удаляет из Redis всё, что связано с удалённым пользователем,
+// и отзывает его ещё не истёкшие токены доступа
+func (s *Service) ForgetUser(ctx context.Context, userID int, email string) error {
+	email = normalizeEmail(email)
+	keys := []string{
+		emailFailuresKey(email),
+		emailLockKey(email),
+		"pwreset_limit:" + email,
+		"magic_link_limit:" + email,
+		fmt.Sprintf("verify_resend:%d", userID),
+		fmt.Sprintf("email_change_limit:%d", userID),
+	}
+
+	iter := s.rdb.Scan(ctx, 0, fmt.Sprintf("totp_used:%d:*", userID), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan user keys: %w", err)
+	}
+
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete user keys: %w", err)
+	}
+
+	// Метка отзыва истечёт сама вместе с последним токеном доступа
+	return s.denylist.RevokeUser(ctx, userID, s.cfg.AccessTokenTTL)
+}
+
+// ChangePassword меняет пароль после проверки текущего и завершает
+// все остальные сессии пользователя; текущая остаётся активной.
+// Пароль, отзыв сессий в БД и запись аудита фиксируются одной транзакцией
+func (s *Service) ChangePassword(ctx context.Context, principal *middleware.Principal, req ChangePasswordRequest, client ClientInfo) error {
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := s.ConfirmPassword(ctx, principal.UserID, principal.Email, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, principal.UserID)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка получения пользователя")
+	}
+	if err := s.passwords.Validate(ctx, req.NewPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка хеширования пароля")
+	}
+
+	var revoked []string
+	err = s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := s.repo.UpdatePasswordTx(ctx, tx, principal.UserID, string(hashedPassword)); err != nil {
+			return err
+		}
+		var err error
+		revoked, err = s.repo.RevokeSessionsTx(ctx, tx, principal.UserID, principal.SessionID)
+		if err != nil {
+			return err
+		}
+		return s.audit.RecordTx(ctx, tx, selfAuditEntry(principal.UserID, ActionPasswordChange, client, nil))
+	})
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка смены пароля")
+	}
+
+	s.revokeSessionTokens(ctx, revoked)
+	s.recordEvent(ctx, principal.UserID, EventPasswordChange, OutcomeSuccess, client, nil)
+
+	go s.sendSecurityNotice(principal.Email, "Пароль Finopp изменён", `Здравствуйте!
+
+Пароль от вашего аккаунта Finopp только что изменён, остальные устройства отключены.
+Если это были не вы, восстановите доступ через «Забыли пароль?» и свяжитесь с поддержкой.`)
+	return nil
+}
+
+// ChangeEmail отправляет ссылку для подтверждения на новый адрес.
+// Адрес меняется только после перехода по ссылке
+func (s *Service) ChangeEmail(ctx context.Context, principal *middleware.Principal, req ChangeEmailRequest, client ClientInfo) error {
+	newEmail := strings.TrimSpace(req.NewEmail)
+	if newEmail == "" || req.Password == "" {
+		return apperrors.ErrBadRequest
+	}
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		return errInvalidEmail
+	}
+	if normalizeEmail(newEmail) == normalizeEmail(principal.Email) {
+		return errSameEmail
+	}
+
+	if err := s.ConfirmPassword(ctx, principal.UserID, principal.Email, req.Password); err != nil {
+		return err
+	}
+
+	limited, _, err := s.hitLimit(ctx, fmt.Sprintf("email_change_limit:%d", principal.UserID), emailChangeLimit, emailChangeWindow)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки лимита")
+	}
+	if limited {
+		return apperrors.ErrTooManyRequests
+	}
+
+	exists, err := s.repo.EmailExists(newEmail)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки email")
+	}
+	if exists {
+		return apperrors.ErrEmailExists
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+	if err := s.repo.CreateUserToken(ctx, principal.UserID, tokenPurposeEmailChange, tokenHash, newEmail, time.Now().Add(emailChangeTTL)); err != nil {
+		return apperrors.Wrap(err, "Ошибка сохранения токена")
+	}
+
+	if err := s.record(ctx, principal.UserID, ActionEmailChangeRequest, client, map[string]any{"newEmail": newEmail}); err != nil {
+		return err
+	}
+
+	go s.sendEmailChangeConfirmation(principal.Email, newEmail, token)
+	return nil
+}
+
+// ConfirmEmailChange меняет адрес по ссылке из письма. Токен гасится в одной
+// транзакции со сменой адреса и записью аудита. Выданные токены доступа
+// отзываются после фиксации, потому что содержат старый адрес
+func (s *Service) ConfirmEmailChange(ctx context.Context, token string, client ClientInfo) error {
+	if token == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	var user *User
+	var newEmail string
+	err := s.repo.WithTx(ctx, func(tx *sql.Tx) error {
+		userID, payload, err := s.repo.ConsumeUserTokenTx(ctx, tx, tokenPurposeEmailChange, hashToken(token))
+		if err != nil {
+			return err
+		}
+		if payload == "" {
+			return errUserTokenInvalid
+		}
+		newEmail = payload
+
+		if user, err = s.repo.GetUserByID(ctx, userID); err != nil {
+			return errUserTokenInvalid
+		}
+		if err := s.repo.UpdateEmailTx(ctx, tx, userID, newEmail); err != nil {
+			return err
+		}
+		return s.audit.RecordTx(ctx, tx, selfAuditEntry(userID, ActionEmailChange, client, map[string]any{"from": user.Email, "to": newEmail}))
+	})
+	if errors.Is(err, errUserTokenInvalid) {
+		return apperrors.ErrInvalidToken
+	}
+	if errors.Is(err, errEmailTaken) {
+		return apperrors.ErrEmailExists
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка смены email")
+	}
+
+	if err := s.RevokeAccessTokens(ctx, user.ID); err != nil {
+		// Адрес уже сменён: старые токены доступа доживут свой короткий срок
+		log.Printf("Failed to revoke access tokens after email change: %v", err)
+	}
+	s.recordEvent(ctx, user.ID, EventEmailChange, OutcomeSuccess, client, nil)
+
+	go s.sendSecurityNotice(user.Email, "Email в Finopp изменён", fmt.Sprintf(`Здравствуйте!
+
+Адрес для входа в ваш аккаунт Finopp изменён на %s.
+Если это были не вы, срочно свяжитесь с поддержкой.`, newEmail))
+	return nil
+}
+
+func (s *Service) sendEmailChangeConfirmation(oldEmail, newEmail, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", strings.TrimRight(s.cfg.AppBaseURL, "/"), url.QueryEscape(token))
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Подтвердите новый email в Finopp",
+		Body: fmt.Sprintf(`Здравствуйте!
+
+Чтобы входить в Finopp с этим адресом вместо %s, перейдите по ссылке:
+
+%s
+
+Ссылка действует %d часа. Если вы не меняли адрес, просто проигнорируйте это письмо.`, oldEmail, link, int(emailChangeTTL.Hours())),
+	})
+	if err != nil {
+		log.Printf("Failed to send email change confirmation: %v", err)
+	}
+}
+
+// sendSecurityNotice сообщает пользователю об изменении учётных данных
+func (s *Service) sendSecurityNotice(to, subject, body string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	if err := s.mailer.Send(ctx, mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+		log.Printf("Failed to send security notice: %v", err)
+	}
+}
+
+// record пишет действие пользователя над своим аккаунтом в журнал аудита
+func (s *Service) record(ctx context.Context, userID int, action string, client ClientInfo, details map[string]any) error {
+	if err := s.audit.Record(ctx, selfAuditEntry(userID, action, client, details)); err != nil {
+		return apperrors.Wrap(err, "Ошибка записи в журнал аудита")
+	}
+	return nil
+}
+
+// selfAuditEntry — запись аудита о действии пользователя над своим аккаунтом
+func selfAuditEntry(userID int, action string, client ClientInfo, details map[string]any) audit.Entry {
+	return audit.Entry{
+		ActorID:      userID,
+		Action:       action,
+		TargetUserID: userID,
+		IP:           client.IP,
+		Details:      details,
+	}
+}
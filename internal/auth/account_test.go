@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	"github.com/Kir-Khorev/finopp-back/internal/passwords"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type discardMailer struct{}
+
+func (discardMailer) Send(context.Context, mailer.Message) error { return nil }
+
+// accountTest — Service с журналом аудита поверх sqlmock и miniredis
+type accountTest struct {
+	service *Service
+	db      sqlmock.Sqlmock
+	redis   *miniredis.Miniredis
+}
+
+func newAccountTest(t *testing.T) *accountTest {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	policy := passwords.NewPolicy(passwords.Config{MinLength: 8, MinClasses: 2}, nil)
+	service := NewService(NewRepository(db), rdb, discardMailer{}, nil, audit.NewRepository(db), policy, Config{
+		AccessTokenTTL: 15 * time.Minute,
+	})
+	return &accountTest{service: service, db: mock, redis: mr}
+}
+
+var (
+	sqlConsumeToken    = regexp.QuoteMeta(`UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP`)
+	sqlUserByID        = regexp.QuoteMeta(`FROM users WHERE id = $1`)
+	sqlUpdateEmail     = regexp.QuoteMeta(`UPDATE users`)
+	sqlPasswordHash    = regexp.QuoteMeta(`SELECT password_hash FROM users WHERE id = $1`)
+	sqlUpdatePassword  = regexp.QuoteMeta(`UPDATE users SET password_hash = $1`)
+	sqlRevokeSessions  = regexp.QuoteMeta(`UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP`)
+	sqlRevokeRefreshes = regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP`)
+	sqlAuditLog        = regexp.QuoteMeta(`INSERT INTO audit_log`)
+)
+
+var userByIDColumns = []string{"id", "email", "name", "verified", "mfa", "role", "disabled"}
+
+func (a *accountTest) expectEmailChange() {
+	a.db.ExpectBegin()
+	a.db.ExpectQuery(sqlConsumeToken).WillReturnRows(sqlmock.NewRows([]string{"user_id", "payload"}).AddRow(3, "new@example.com"))
+	a.db.ExpectQuery(sqlUserByID).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(userByIDColumns).AddRow(3, "old@example.com", "Анна", true, false, "user", false))
+	a.db.ExpectExec(sqlUpdateEmail).WithArgs(3, "new@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestConfirmEmailChangeRollsBackWithoutAudit(t *testing.T) {
+	a := newAccountTest(t)
+	a.expectEmailChange()
+	a.db.ExpectExec(sqlAuditLog).WillReturnError(errors.New("audit_log is unavailable"))
+	// Откат возвращает и адрес, и погашенный токен
+	a.db.ExpectRollback()
+
+	err := a.service.ConfirmEmailChange(context.Background(), "token", testClient)
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != http.StatusInternalServerError {
+		t.Fatalf("ConfirmEmailChange = %v, want 500", err)
+	}
+	if a.redis.Exists(revokedUserKey(3)) {
+		t.Fatal("access tokens revoked although the change was rolled back")
+	}
+	if err := a.db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmEmailChangeRevokesAfterCommit(t *testing.T) {
+	a := newAccountTest(t)
+	a.expectEmailChange()
+	a.db.ExpectExec(sqlAuditLog).WithArgs(3, ActionEmailChange, 3, testClient.IP, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	a.db.ExpectCommit()
+	a.db.ExpectExec(sqlAuthEvent).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := a.service.ConfirmEmailChange(context.Background(), "token", testClient); err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	if !a.redis.Exists(revokedUserKey(3)) {
+		t.Fatal("access tokens with the old email were not revoked")
+	}
+	if err := a.db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (a *accountTest) expectPasswordChange(t *testing.T) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("old-password-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.db.ExpectQuery(sqlPasswordHash).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(string(hash)))
+	a.db.ExpectQuery(sqlUserByID).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows(userByIDColumns).AddRow(3, "anna@example.com", "Анна", true, false, "user", false))
+	a.db.ExpectBegin()
+	a.db.ExpectExec(sqlUpdatePassword).WillReturnResult(sqlmock.NewResult(0, 1))
+	a.db.ExpectQuery(sqlRevokeSessions).WithArgs(3, "current").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("other"))
+	a.db.ExpectExec(sqlRevokeRefreshes).WithArgs(3, "current").WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func changePassword(a *accountTest) error {
+	principal := &middleware.Principal{UserID: 3, Email: "anna@example.com", SessionID: "current"}
+	req := ChangePasswordRequest{CurrentPassword: "old-password-1", NewPassword: "brand-new-password-2"}
+	return a.service.ChangePassword(context.Background(), principal, req, testClient)
+}
+
+func TestChangePasswordRollsBackWithoutAudit(t *testing.T) {
+	a := newAccountTest(t)
+	a.expectPasswordChange(t)
+	a.db.ExpectExec(sqlAuditLog).WillReturnError(errors.New("audit_log is unavailable"))
+	a.db.ExpectRollback()
+
+	err := changePassword(a)
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != http.StatusInternalServerError {
+		t.Fatalf("ChangePassword = %v, want 500", err)
+	}
+	if a.redis.Exists("revoked_session:other") {
+		t.Fatal("session tokens revoked although the change was rolled back")
+	}
+	if err := a.db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangePasswordRevokesSessionsAfterCommit(t *testing.T) {
+	a := newAccountTest(t)
+	a.expectPasswordChange(t)
+	a.db.ExpectExec(sqlAuditLog).WithArgs(3, ActionPasswordChange, 3, testClient.IP, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	a.db.ExpectCommit()
+	a.db.ExpectExec(sqlAuthEvent).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := changePassword(a); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if !a.redis.Exists("revoked_session:other") {
+		t.Fatal("access tokens of the other session were not revoked")
+	}
+	if a.redis.Exists("revoked_session:current") {
+		t.Fatal("current session was revoked")
+	}
+	if err := a.db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
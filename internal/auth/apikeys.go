@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+const (
+	// Ключ выглядит как fo_<8 hex>_<секрет>; fo_<8 hex> хранится открыто,
+	// чтобы пользователь мог узнать ключ в списке
+	apiKeyPrefix       = "fo_"
+	maxAPIKeysPerUser  = 20
+	maxAPIKeyNameLen   = 100
+	maxAPIKeyTTLInDays = 365
+)
+
+var errAPIKeyLimit = apperrors.New(http.StatusConflict, "Достигнут лимит API-ключей, отзовите ненужные")
+
+// newAPIKey генерирует ключ, его видимый префикс и хеш для хранения
+func newAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = apiKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, hashToken(key), nil
+}
+
+// CreateAPIKey выпускает персональный API-ключ. Сам ключ возвращается только здесь
+func (s *Service) CreateAPIKey(ctx context.Context, userID int, req CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len([]rune(name)) > maxAPIKeyNameLen {
+		return nil, apperrors.NewWithDetails(http.StatusBadRequest, "Неверный запрос", "Укажите название ключа до 100 символов")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, apperrors.NewWithDetails(http.StatusBadRequest, "Неверный запрос", "Выберите хотя бы одно право")
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			return nil, apperrors.NewWithDetails(http.StatusBadRequest, "Неизвестное право", scope)
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyTTLInDays {
+		return nil, apperrors.NewWithDetails(http.StatusBadRequest, "Неверный запрос", "Срок действия — от 1 до 365 дней")
+	}
+
+	count, err := s.repo.CountActiveAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка создания ключа")
+	}
+	if count >= maxAPIKeysPerUser {
+		return nil, errAPIKeyLimit
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации ключа")
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	apiKey, err := s.repo.CreateAPIKey(ctx, userID, name, prefix, hash, dedupScopes(req.Scopes), expiresAt)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка создания ключа")
+	}
+
+	return &CreatedAPIKey{APIKey: *apiKey, Key: key}, nil
+}
+
+// ListAPIKeys возвращает ключи пользователя без секретов
+func (s *Service) ListAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка получения ключей")
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ; запросы с ним сразу перестают проходить
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, keyID int) error {
+	err := s.repo.RevokeAPIKey(ctx, userID, keyID)
+	if errors.Is(err, errAPIKeyNotFound) {
+		return apperrors.ErrNotFound
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка отзыва ключа")
+	}
+	return nil
+}
+
+// VerifyAPIKey реализует middleware.TokenVerifier для заголовка "ApiKey <key>"
+func (s *Service) VerifyAPIKey(ctx context.Context, key string) (*middleware.Principal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	owner, err := s.repo.UseAPIKey(ctx, hashToken(key))
+	if errors.Is(err, errAPIKeyNotFound) {
+		return nil, apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки ключа")
+	}
+
+	principal := &middleware.Principal{
+		UserID:        owner.UserID,
+		Email:         owner.Email,
+		EmailVerified: owner.EmailVerified,
+		APIKeyID:      owner.KeyID,
+		Scopes:        owner.Scopes,
+	}
+	if owner.ExpiresAt != nil {
+		principal.ExpiresAt = *owner.ExpiresAt
+	}
+	return principal, nil
+}
+
+func validScope(scope string) bool {
+	for _, s := range middleware.AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Denylist хранит в Redis отозванные токены доступа (по jti) до истечения их срока
+type Denylist struct {
+	rdb *redis.Client
+}
+
+func NewDenylist(rdb *redis.Client) *Denylist {
+	return &Denylist{rdb: rdb}
+}
+
+// Revoke отзывает токен; ttl — оставшееся время жизни токена
+func (d *Denylist) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil // токен уже истёк сам
+	}
+	return d.rdb.Set(ctx, "revoked_jti:"+jti, 1, ttl).Err()
+}
+
+// RevokeUser отзывает все токены пользователя, выданные до текущего момента;
+// ttl — время жизни токена доступа, после него старые токены истекут сами
+func (d *Denylist) RevokeUser(ctx context.Context, userID int, ttl time.Duration) error {
+	return d.rdb.Set(ctx, revokedUserKey(userID), time.Now().Unix(), ttl).Err()
+}
+
+// RevokeSession отзывает токены доступа одной сессии (устройства)
+func (d *Denylist) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	return d.rdb.Set(ctx, "revoked_session:"+sessionID, 1, ttl).Err()
+}
+
+// IsRevoked проверяет отзыв конкретного токена, его сессии и всех токенов пользователя
+func (d *Denylist) IsRevoked(ctx context.Context, jti string, userID int, sessionID string, issuedAt time.Time) (bool, error) {
+	values, err := d.rdb.MGet(ctx, "revoked_jti:"+jti, "revoked_session:"+sessionID, revokedUserKey(userID)).Result()
+	if err != nil {
+		return false, err
+	}
+	if values[0] != nil || (sessionID != "" && values[1] != nil) {
+		return true, nil
+	}
+	if revokedAt, ok := values[2].(string); ok {
+		ts, err := strconv.ParseInt(revokedAt, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		// iat хранится с точностью до секунды; токены, выданные в секунду отзыва,
+		// остаются в силе, иначе сразу после отзыва нельзя было бы получить новый
+		return issuedAt.Unix() < ts, nil
+	}
+	return false, nil
+}
+
+func revokedUserKey(userID int) string {
+	return "revoked_user:" + strconv.Itoa(userID)
+}
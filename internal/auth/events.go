@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// Типы событий журнала безопасности (auth_events)
+const (
+	EventRegister       = "register"
+	EventLogin          = "login"
+	EventMFA            = "mfa"
+	EventRefreshReuse   = "refresh_token_reuse"
+	EventLogout         = "logout"
+	EventPasswordReset  = "password_reset"
+	EventPasswordChange = "password_change"
+	EventEmailChange    = "email_change"
+	EventMFAEnable      = "mfa_enable"
+	EventMFADisable     = "mfa_disable"
+)
+
+// Результат события
+const (
+	OutcomeSuccess     = "success"
+	OutcomeFailure     = "failure"
+	OutcomeMFARequired = "mfa_required" // пароль верный, ждём второй фактор
+)
+
+// Способ входа в details.method
+const (
+	loginMethodPassword  = "password"
+	loginMethodMagicLink = "magic_link"
+	loginMethodOAuth     = "oauth"
+)
+
+const (
+	defaultEventsPageSize = 50
+	maxEventsPageSize     = 100
+)
+
+// recordEvent пишет событие в журнал безопасности. Ошибка записи только логируется:
+// из-за неё вход не должен отказывать
+func (s *Service) recordEvent(ctx context.Context, userID int, eventType, outcome string, client ClientInfo, details map[string]any) {
+	// Запись не должна теряться, если клиент оборвал запрос (например, при переборе паролей)
+	ctx = context.WithoutCancel(ctx)
+
+	err := s.repo.RecordAuthEvent(ctx, userID, AuthEvent{
+		Type:      eventType,
+		Outcome:   outcome,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Failed to record auth event %s for user %d: %v", eventType, userID, err)
+	}
+}
+
+// loginDetails описывает способ входа; пустые поля не сохраняются
+func loginDetails(method, provider, reason string) map[string]any {
+	details := map[string]any{"method": method}
+	if provider != "" {
+		details["provider"] = provider
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	return details
+}
+
+// ListAuthEvents возвращает журнал безопасности пользователя с курсорной пагинацией
+func (s *Service) ListAuthEvents(ctx context.Context, principal *middleware.Principal, cursor string, limit int) (*AuthEventListResponse, error) {
+	var after int64
+	if cursor != "" {
+		var err error
+		after, err = strconv.ParseInt(cursor, 10, 64)
+		if err != nil || after <= 0 {
+			return nil, apperrors.NewWithDetails(400, "Неверный курсор", "cursor must be a value from nextCursor")
+		}
+	}
+	if limit <= 0 {
+		limit = defaultEventsPageSize
+	}
+	if limit > maxEventsPageSize {
+		limit = maxEventsPageSize
+	}
+
+	events, err := s.repo.ListAuthEvents(ctx, principal.UserID, after, limit+1)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки журнала")
+	}
+
+	resp := &AuthEventListResponse{Events: events}
+	if len(events) > limit {
+		resp.Events = events[:limit]
+		resp.NextCursor = strconv.FormatInt(events[limit-1].ID, 10)
+	}
+	return resp, nil
+}
+
+// PruneAuthEvents удаляет события старше срока хранения
+func (s *Service) PruneAuthEvents(ctx context.Context) error {
+	if s.cfg.EventRetention <= 0 {
+		return nil
+	}
+
+	deleted, err := s.repo.DeleteAuthEventsBefore(ctx, time.Now().Add(-s.cfg.EventRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("Pruned %d auth events", deleted)
+	}
+	return nil
+}
+
+// Run периодически чистит журнал безопасности, пока не отменён ctx
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PruneAuthEvents(ctx); err != nil {
+			log.Printf("Failed to prune auth events: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
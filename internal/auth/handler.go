@@ -1,16 +1,23 @@
 package auth
 
 import (
+	"net/http"
+	"strconv"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
 	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
 	"github.com/labstack/echo/v4"
 )
 
 type Handler struct {
 	service *Service
+	// secureCookies: cookie ставятся с Secure и SameSite=None — фронтенд живёт
+	// на другом сайте и обращается к API через fetch. Выключается только в development
+	secureCookies bool
 }
 
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *Service, secureCookies bool) *Handler {
+	return &Handler{service: service, secureCookies: secureCookies}
 }
 
 func (h *Handler) Register(c echo.Context) error {
@@ -19,7 +26,7 @@ func (h *Handler) Register(c echo.Context) error {
 		return apperrors.ErrBadRequest
 	}
 
-	resp, err := h.service.Register(req)
+	resp, err := h.service.Register(c.Request().Context(), req, clientInfo(c))
 	if err != nil {
 		return err
 	}
@@ -33,7 +40,22 @@ func (h *Handler) Login(c echo.Context) error {
 		return apperrors.ErrBadRequest
 	}
 
-	resp, err := h.service.Login(req)
+	resp, err := h.service.Login(c.Request().Context(), req, clientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+// Refresh выдаёт новую пару токенов; старый refresh-токен после этого недействителен
+func (h *Handler) Refresh(c echo.Context) error {
+	var req RefreshRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	resp, err := h.service.Refresh(c.Request().Context(), req, clientInfo(c))
 	if err != nil {
 		return err
 	}
@@ -41,3 +63,342 @@ func (h *Handler) Login(c echo.Context) error {
 	return c.JSON(200, resp)
 }
 
+// Logout отзывает текущий токен доступа и, если передан, refresh-токен
+func (h *Handler) Logout(c echo.Context) error {
+	var req LogoutRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.Logout(c.Request().Context(), middleware.GetPrincipal(c), req, clientInfo(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForgotPassword всегда отвечает 202, чтобы не раскрывать, зарегистрирован ли адрес
+func (h *Handler) ForgotPassword(c echo.Context) error {
+	var req ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.ForgotPassword(c.Request().Context(), req); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "Если адрес зарегистрирован, мы отправили на него ссылку для сброса пароля",
+	})
+}
+
+// RequestMagicLink всегда отвечает 202, чтобы не раскрывать, зарегистрирован ли адрес
+func (h *Handler) RequestMagicLink(c echo.Context) error {
+	var req MagicLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.RequestMagicLink(c.Request().Context(), req); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "Если адрес зарегистрирован, мы отправили на него ссылку для входа",
+	})
+}
+
+// ConsumeMagicLink выполняет вход по ссылке из письма
+func (h *Handler) ConsumeMagicLink(c echo.Context) error {
+	resp, err := h.service.ConsumeMagicLink(c.Request().Context(), c.QueryParam("token"), clientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+func (h *Handler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.ResetPassword(c.Request().Context(), req, clientInfo(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// VerifyEmail подтверждает адрес по ссылке из письма (?token=)
+func (h *Handler) VerifyEmail(c echo.Context) error {
+	if err := h.service.VerifyEmail(c.Request().Context(), c.QueryParam("token")); err != nil {
+		return err
+	}
+
+	return c.JSON(200, map[string]string{
+		"message": "Email подтверждён",
+	})
+}
+
+func (h *Handler) ResendVerification(c echo.Context) error {
+	if err := h.service.ResendVerification(c.Request().Context(), middleware.GetPrincipal(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// VerifyMFA — второй шаг входа: обмен mfaToken и кода на токены
+func (h *Handler) VerifyMFA(c echo.Context) error {
+	var req MFAVerifyRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	resp, err := h.service.VerifyMFA(c.Request().Context(), req, clientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+func (h *Handler) EnrollTOTP(c echo.Context) error {
+	resp, err := h.service.EnrollTOTP(c.Request().Context(), middleware.GetPrincipal(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+func (h *Handler) ConfirmTOTP(c echo.Context) error {
+	var req TOTPConfirmRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	resp, err := h.service.ConfirmTOTP(c.Request().Context(), middleware.GetPrincipal(c), req, clientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+func (h *Handler) DisableTOTP(c echo.Context) error {
+	var req TOTPDisableRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.DisableTOTP(c.Request().Context(), middleware.GetPrincipal(c), req, clientInfo(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// OAuthProviders перечисляет доступные способы социального входа
+func (h *Handler) OAuthProviders(c echo.Context) error {
+	return c.JSON(200, OAuthProvidersResponse{Providers: h.service.OAuthProviders()})
+}
+
+// StartOAuth возвращает ссылку на страницу входа провайдера и ставит браузеру
+// cookie с nonce, без которой callback не примет code
+func (h *Handler) StartOAuth(c echo.Context) error {
+	nonce, err := randomID()
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	resp, err := h.service.StartOAuth(c.Request().Context(), c.Param("provider"), nonce)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(oauthNonceCookie(nonce, int(oauthStateTTL.Seconds()), h.secureCookies))
+	return c.JSON(200, resp)
+}
+
+// OAuthCallback завершает вход: фронтенд передаёт code и state из адреса возврата
+func (h *Handler) OAuthCallback(c echo.Context) error {
+	var req OAuthCallbackRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	var nonce string
+	if cookie, err := c.Cookie(OAuthNonceCookie); err == nil {
+		nonce = cookie.Value
+	}
+	// cookie одноразовая, как и state
+	c.SetCookie(oauthNonceCookie("", -1, h.secureCookies))
+
+	resp, err := h.service.CompleteOAuth(c.Request().Context(), c.Param("provider"), req, nonce, clientInfo(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+// oauthNonceCookie видна только эндпоинтам входа; maxAge < 0 удаляет её.
+// Фронтенд вызывает start и callback через fetch с другого сайта, а такие запросы
+// браузер отправляет только с cookie SameSite=None, которая обязана быть Secure.
+// Схему запроса не смотрим: X-Forwarded-Proto присылает клиент
+func oauthNonceCookie(nonce string, maxAge int, secure bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     OAuthNonceCookie,
+		Value:    nonce,
+		Path:     "/api/v1/auth/oauth",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		// В development фронтенд и API на localhost — это один сайт
+		SameSite: http.SameSiteLaxMode,
+	}
+	if secure {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// CreateAPIKey выпускает персональный API-ключ; ключ показывается один раз
+func (h *Handler) CreateAPIKey(c echo.Context) error {
+	var req CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	resp, err := h.service.CreateAPIKey(c.Request().Context(), c.Get("user_id").(int), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, resp)
+}
+
+func (h *Handler) ListAPIKeys(c echo.Context) error {
+	keys, err := h.service.ListAPIKeys(c.Request().Context(), c.Get("user_id").(int))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, APIKeyListResponse{Keys: keys})
+}
+
+func (h *Handler) RevokeAPIKey(c echo.Context) error {
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.RevokeAPIKey(c.Request().Context(), c.Get("user_id").(int), keyID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) ListSessions(c echo.Context) error {
+	sessions, err := h.service.ListSessions(c.Request().Context(), middleware.GetPrincipal(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, UserSessionListResponse{Sessions: sessions})
+}
+
+func (h *Handler) RevokeSession(c echo.Context) error {
+	if err := h.service.RevokeSession(c.Request().Context(), middleware.GetPrincipal(c), c.Param("id")); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) RevokeOtherSessions(c echo.Context) error {
+	if err := h.service.RevokeOtherSessions(c.Request().Context(), middleware.GetPrincipal(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListSecurityEvents — GET /me/security-events?cursor=&limit=
+func (h *Handler) ListSecurityEvents(c echo.Context) error {
+	limit := 0
+	if raw := c.QueryParam("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil {
+			return apperrors.NewWithDetails(400, "Неверный параметр limit", err.Error())
+		}
+	}
+
+	resp, err := h.service.ListAuthEvents(c.Request().Context(), middleware.GetPrincipal(c), c.QueryParam("cursor"), limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, resp)
+}
+
+// ChangePassword меняет пароль; остальные сессии завершаются
+func (h *Handler) ChangePassword(c echo.Context) error {
+	var req ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.ChangePassword(c.Request().Context(), middleware.GetPrincipal(c), req, clientInfo(c)); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ChangeEmail отправляет ссылку для подтверждения на новый адрес
+func (h *Handler) ChangeEmail(c echo.Context) error {
+	var req ChangeEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.ErrBadRequest
+	}
+
+	if err := h.service.ChangeEmail(c.Request().Context(), middleware.GetPrincipal(c), req, clientInfo(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"message": "Мы отправили ссылку для подтверждения на новый адрес",
+	})
+}
+
+// ConfirmEmailChange меняет адрес по ссылке из письма (?token=)
+func (h *Handler) ConfirmEmailChange(c echo.Context) error {
+	if err := h.service.ConfirmEmailChange(c.Request().Context(), c.QueryParam("token"), clientInfo(c)); err != nil {
+		return err
+	}
+
+	return c.JSON(200, map[string]string{
+		"message": "Email изменён. Войдите заново или обновите токен",
+	})
+}
+
+// JWKS отдаёт открытые ключи проверки токенов для других сервисов
+func (h *Handler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(200, h.service.JWKS())
+}
+
+// clientInfo извлекает адрес и user agent клиента из запроса
+func clientInfo(c echo.Context) ClientInfo {
+	return ClientInfo{
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+	}
+}
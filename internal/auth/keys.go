@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const minRSAKeyBits = 2048
+
+// KeyManager подписывает и проверяет JWT.
+//
+// Ключи лежат в каталоге файлами <kid>.pem: закрытые ключи (RSA или Ed25519)
+// пригодны для подписи, открытые — только для проверки. Подписывает один
+// активный ключ, проверка идёт по любому ключу из каталога, поэтому при
+// ротации старый ключ оставляют, пока не истекут выданные им токены.
+//
+// Без каталога используется HS256 с общим секретом — режим для разработки.
+type KeyManager struct {
+	signingKID string
+	signingKey crypto.Signer
+	keys       map[string]crypto.PublicKey
+	hmacSecret []byte
+}
+
+// NewKeyManager загружает ключи из dir; signingKID выбирает активный ключ подписи.
+// Если dir пуст, токены подписываются HS256 секретом hmacSecret
+func NewKeyManager(dir, signingKID, hmacSecret string) (*KeyManager, error) {
+	if dir == "" {
+		if hmacSecret == "" {
+			return nil, errors.New("не задан ни каталог ключей, ни JWT секрет")
+		}
+		return &KeyManager{hmacSecret: []byte(hmacSecret)}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	km := &KeyManager{keys: make(map[string]crypto.PublicKey)}
+	signers := make(map[string]crypto.Signer)
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		public, private, err := loadKeyFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %s: %w", file, err)
+		}
+		km.keys[kid] = public
+		if private != nil {
+			signers[kid] = private
+		}
+	}
+
+	if signingKID == "" && len(signers) == 1 {
+		for kid := range signers {
+			signingKID = kid
+		}
+	}
+	signer, ok := signers[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("в %s нет закрытого ключа для подписи (kid %q)", dir, signingKID)
+	}
+
+	km.signingKID = signingKID
+	km.signingKey = signer
+	return km, nil
+}
+
+// loadKeyFile читает PEM с закрытым (PKCS#8/PKCS#1) или открытым (PKIX) ключом
+func loadKeyFile(path string) (crypto.PublicKey, crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("не PEM")
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("неподдерживаемый тип PEM %q", block.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, nil, fmt.Errorf("RSA ключ короче %d бит", minRSAKeyBits)
+		}
+		return &k.PublicKey, k, nil
+	case ed25519.PrivateKey:
+		return k.Public(), k, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, nil, fmt.Errorf("RSA ключ короче %d бит", minRSAKeyBits)
+		}
+		return k, nil, nil
+	case ed25519.PublicKey:
+		return k, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("неподдерживаемый тип ключа %T", key)
+	}
+}
+
+// Sign подписывает claims активным ключом
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	if km.signingKey == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(km.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(signingMethod(km.signingKey.Public()), claims)
+	token.Header["kid"] = km.signingKID
+	return token.SignedString(km.signingKey)
+}
+
+// Parse проверяет подпись токена по его kid и заполняет claims
+func (km *KeyManager) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	if km.signingKey == nil {
+		opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		return jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+			return km.hmacSecret, nil
+		}, opts...)
+	}
+
+	// HS256 в асимметричном режиме не принимается, иначе открытый ключ
+	// можно было бы использовать как HMAC секрет
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := km.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный kid %q", kid)
+		}
+		if signingMethod(key).Alg() != token.Method.Alg() {
+			return nil, errors.New("алгоритм не соответствует ключу")
+		}
+		return key, nil
+	}, opts...)
+}
+
+func signingMethod(key crypto.PublicKey) jwt.SigningMethod {
+	if _, ok := key.(ed25519.PublicKey); ok {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK — открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet — ответ /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает все открытые ключи проверки. В режиме HS256 список пуст:
+// общий секрет публиковать нельзя
+func (km *KeyManager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	kids := make([]string, 0, len(km.keys))
+	for kid := range km.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		switch key := km.keys[kid].(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: jwt.SigningMethodRS256.Alg(),
+				Kid: kid,
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: jwt.SigningMethodEdDSA.Alg(),
+				Kid: kid,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+	}
+
+	return set
+}
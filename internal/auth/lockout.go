@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Защита /auth/login от перебора: счётчики неудач по email и по IP в Redis.
+// После порога включается блокировка, длительность которой удваивается
+// с каждой следующей неудачей.
+const (
+	loginFailureWindow = time.Hour
+
+	emailFailureThreshold = 5
+	ipFailureThreshold    = 20
+	// mfaFailureThreshold — неверные коды второго фактора считаются по пользователю,
+	// а не по challenge: иначе, зная пароль, коды перебирали бы через новые challenge
+	mfaFailureThreshold = 5
+
+	lockoutBase = time.Minute
+	lockoutMax  = time.Hour
+)
+
+// dummyPasswordHash сравнивается с паролем, когда пользователя нет,
+// чтобы время ответа не выдавало, зарегистрирован ли email
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("finopp-timing-equalizer"), bcrypt.DefaultCost)
+
+func emailFailuresKey(email string) string { return "login_fail:email:" + email }
+func emailLockKey(email string) string     { return "login_lock:email:" + email }
+func ipFailuresKey(ip string) string       { return "login_fail:ip:" + ip }
+func ipLockKey(ip string) string           { return "login_lock:ip:" + ip }
+func mfaFailuresKey(userID int) string     { return fmt.Sprintf("mfa_fail:user:%d", userID) }
+func mfaLockKey(userID int) string         { return fmt.Sprintf("mfa_lock:user:%d", userID) }
+
+// checkLoginLock возвращает ErrAccountLocked с Retry-After, если вход временно заблокирован
+func (s *Service) checkLoginLock(ctx context.Context, email, ip string) error {
+	keys := []string{emailLockKey(email)}
+	if ip != "" {
+		keys = append(keys, ipLockKey(ip))
+	}
+	return s.checkLocks(ctx, keys...)
+}
+
+// checkMFALock возвращает ErrAccountLocked, если ввод второго фактора временно заблокирован
+func (s *Service) checkMFALock(ctx context.Context, userID int) error {
+	return s.checkLocks(ctx, mfaLockKey(userID))
+}
+
+func (s *Service) checkLocks(ctx context.Context, keys ...string) error {
+	var wait time.Duration
+	for _, key := range keys {
+		ttl, err := s.rdb.PTTL(ctx, key).Result()
+		if err != nil {
+			return apperrors.Wrap(err, "Ошибка проверки блокировки")
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+
+	if wait > 0 {
+		return apperrors.WithRetryAfter(apperrors.ErrAccountLocked, wait)
+	}
+	return nil
+}
+
+// recordLoginFailure учитывает неудачную попытку и при необходимости блокирует вход
+func (s *Service) recordLoginFailure(ctx context.Context, email, ip string) error {
+	if err := s.countFailure(ctx, emailFailuresKey(email), emailLockKey(email), emailFailureThreshold); err != nil {
+		return apperrors.Wrap(err, "Ошибка учёта попытки входа")
+	}
+	if ip != "" {
+		if err := s.countFailure(ctx, ipFailuresKey(ip), ipLockKey(ip), ipFailureThreshold); err != nil {
+			return apperrors.Wrap(err, "Ошибка учёта попытки входа")
+		}
+	}
+	return nil
+}
+
+// recordMFAFailure учитывает неверный код второго фактора
+func (s *Service) recordMFAFailure(ctx context.Context, userID int) error {
+	if err := s.countFailure(ctx, mfaFailuresKey(userID), mfaLockKey(userID), mfaFailureThreshold); err != nil {
+		return apperrors.Wrap(err, "Ошибка учёта попытки входа")
+	}
+	return nil
+}
+
+func (s *Service) countFailure(ctx context.Context, failuresKey, lockKey string, threshold int64) error {
+	pipe := s.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, failuresKey)
+	pipe.Expire(ctx, failuresKey, loginFailureWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	failures := incr.Val()
+	if failures < threshold {
+		return nil
+	}
+
+	return s.rdb.Set(ctx, lockKey, 1, lockoutDuration(failures-threshold)).Err()
+}
+
+// lockoutDuration: 1, 2, 4, 8… минут, но не больше часа
+func lockoutDuration(excess int64) time.Duration {
+	d := lockoutBase
+	for i := int64(0); i < excess && d < lockoutMax; i++ {
+		d *= 2
+	}
+	if d > lockoutMax {
+		d = lockoutMax
+	}
+	return d
+}
+
+// resetLoginFailures снимает блокировку email после успешного входа или сброса пароля.
+// Счётчик по IP не сбрасывается: иначе вход в свой аккаунт обнулял бы перебор чужих.
+// При включённой 2FA вход считается успешным только после второго фактора
+func (s *Service) resetLoginFailures(ctx context.Context, email string) error {
+	return s.rdb.Del(ctx, emailFailuresKey(email), emailLockKey(email)).Err()
+}
+
+// resetMFAFailures снимает блокировку второго фактора после успешного ввода кода
+func (s *Service) resetMFAFailures(ctx context.Context, userID int) error {
+	return s.rdb.Del(ctx, mfaFailuresKey(userID), mfaLockKey(userID)).Err()
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	tokenTypeMagicLink = "magic_link"
+	magicLinkTTL       = 15 * time.Minute
+
+	// Не больше magicLinkLimit писем на один адрес за magicLinkWindow
+	magicLinkLimit  = 5
+	magicLinkWindow = time.Hour
+)
+
+// magicLinkClaims — содержимое подписанной ссылки для входа без пароля
+type magicLinkClaims struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Type   string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+func magicLinkKey(jti string) string {
+	return "magic_link:" + jti
+}
+
+// RequestMagicLink отправляет ссылку для входа без пароля. Как и при входе по паролю,
+// ответ не зависит от того, зарегистрирован ли адрес, а письмо уходит в фоне.
+func (s *Service) RequestMagicLink(ctx context.Context, req MagicLinkRequest) error {
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	limited, _, err := s.hitLimit(ctx, "magic_link_limit:"+email, magicLinkLimit, magicLinkWindow)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки лимита")
+	}
+	if limited {
+		return apperrors.ErrTooManyRequests
+	}
+
+	go s.sendMagicLink(req.Email)
+	return nil
+}
+
+func (s *Service) sendMagicLink(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	user, _, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return // адрес не зарегистрирован — молча ничего не делаем
+	}
+
+	jti, err := randomID()
+	if err != nil {
+		log.Printf("Failed to generate magic link: %v", err)
+		return
+	}
+
+	now := time.Now()
+	token, err := s.keys.Sign(magicLinkClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Type:   tokenTypeMagicLink,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(magicLinkTTL)),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to sign magic link: %v", err)
+		return
+	}
+
+	// Ссылка действительна, пока её jti лежит в Redis: так она срабатывает один раз
+	if err := s.rdb.Set(ctx, magicLinkKey(jti), user.ID, magicLinkTTL).Err(); err != nil {
+		log.Printf("Failed to save magic link: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", strings.TrimRight(s.cfg.AppBaseURL, "/"), url.QueryEscape(token))
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Вход в Finopp",
+		Body: fmt.Sprintf(`Здравствуйте!
+
+Чтобы войти в Finopp без пароля, перейдите по ссылке:
+
+%s
+
+Ссылка действует %d минут и сработает только один раз.
+Если вы не запрашивали вход, просто проигнорируйте это письмо.`, link, int(magicLinkTTL.Minutes())),
+	})
+	if err != nil {
+		log.Printf("Failed to send magic link email: %v", err)
+	}
+}
+
+// ConsumeMagicLink обменивает ссылку из письма на токены
+func (s *Service) ConsumeMagicLink(ctx context.Context, token string, client ClientInfo) (*AuthResponse, error) {
+	if token == "" {
+		return nil, apperrors.ErrBadRequest
+	}
+
+	var claims magicLinkClaims
+	parsed, err := s.keys.Parse(token, &claims, jwt.WithIssuer(s.cfg.Issuer), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid || claims.Type != tokenTypeMagicLink || claims.ID == "" {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	storedID, err := s.rdb.GetDel(ctx, magicLinkKey(claims.ID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки ссылки")
+	}
+	if storedID != strconv.Itoa(claims.UserID) {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil || user.Email != claims.Email {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	// Переход по ссылке из письма подтверждает владение адресом
+	if !user.EmailVerified {
+		if err := s.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка подтверждения email")
+		}
+		user.EmailVerified = true
+	}
+
+	return s.completeLogin(ctx, user, client, loginMethodMagicLink, "")
+}
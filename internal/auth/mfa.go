@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	tokenTypeMFAChallenge = "mfa_challenge"
+
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts — сколько раз можно ввести код по одному challenge
+	mfaMaxAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidMFACode  = apperrors.New(401, "Неверный код подтверждения")
+	errMFAEnabled      = apperrors.New(409, "Двухфакторная аутентификация уже включена")
+	errMFANotEnabled   = apperrors.New(400, "Двухфакторная аутентификация не включена")
+	errMFANotEnrolling = apperrors.New(400, "Сначала получите секрет через /auth/mfa/totp/enroll")
+)
+
+// mfaClaims — содержимое challenge-токена второго шага входа
+type mfaClaims struct {
+	UserID int    `json:"user_id"`
+	Type   string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// completeLogin завершает вход после проверки пароля: выдаёт токены
+// или, если включена 2FA, короткоживущий challenge для второго шага.
+// method и provider попадают в журнал безопасности
+func (s *Service) completeLogin(ctx context.Context, user *User, client ClientInfo, method, provider string) (*AuthResponse, error) {
+	if user.Disabled {
+		s.recordEvent(ctx, user.ID, EventLogin, OutcomeFailure, client, loginDetails(method, provider, "account_disabled"))
+		return nil, errAccountDisabled
+	}
+	if !user.MFAEnabled {
+		resp, err := s.issueTokens(ctx, user, client)
+		if err == nil {
+			s.recordEvent(ctx, user.ID, EventLogin, OutcomeSuccess, client, loginDetails(method, provider, ""))
+		}
+		return resp, err
+	}
+
+	jti, err := randomID()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	now := time.Now()
+	mfaToken, err := s.keys.Sign(mfaClaims{
+		UserID: user.ID,
+		Type:   tokenTypeMFAChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+		},
+	})
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	s.recordEvent(ctx, user.ID, EventLogin, OutcomeMFARequired, client, loginDetails(method, provider, ""))
+	return &AuthResponse{
+		User:        *user,
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}, nil
+}
+
+// VerifyMFA обменивает challenge и код второго фактора на токены
+func (s *Service) VerifyMFA(ctx context.Context, req MFAVerifyRequest, client ClientInfo) (*AuthResponse, error) {
+	if req.MFAToken == "" || req.Code == "" {
+		return nil, apperrors.ErrBadRequest
+	}
+
+	var claims mfaClaims
+	token, err := s.keys.Parse(req.MFAToken, &claims, jwt.WithIssuer(s.cfg.Issuer), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || claims.Type != tokenTypeMFAChallenge || claims.ID == "" {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	limited, _, err := s.hitLimit(ctx, "mfa_attempts:"+claims.ID, mfaMaxAttempts, mfaChallengeTTL)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки лимита")
+	}
+	if limited {
+		return nil, apperrors.ErrTooManyRequests
+	}
+
+	if err := s.checkMFALock(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	secret, enabled, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки кода")
+	}
+	if !enabled {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	if err := s.checkSecondFactor(ctx, user.ID, secret, req.Code); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			s.recordEvent(ctx, user.ID, EventMFA, OutcomeFailure, client, map[string]any{"reason": "invalid_code"})
+			if err := s.recordMFAFailure(ctx, user.ID); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	// Challenge одноразовый: второй обмен того же токена не пройдёт
+	fresh, err := s.rdb.SetNX(ctx, "mfa_used:"+claims.ID, 1, mfaChallengeTTL).Result()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки токена")
+	}
+	if !fresh {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	resp, err := s.issueTokens(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, user.ID, EventMFA, OutcomeSuccess, client, nil)
+
+	// Вход завершён: теперь можно снять счётчики неудач по паролю и по коду
+	if err := s.resetLoginFailures(ctx, normalizeEmail(user.Email)); err != nil {
+		log.Printf("Failed to reset login failures of user %d: %v", user.ID, err)
+	}
+	if err := s.resetMFAFailures(ctx, user.ID); err != nil {
+		log.Printf("Failed to reset MFA failures of user %d: %v", user.ID, err)
+	}
+	return resp, nil
+}
+
+// EnrollTOTP генерирует секрет для подключения приложения-аутентификатора.
+// 2FA включится только после подтверждения кодом.
+func (s *Service) EnrollTOTP(ctx context.Context, principal *middleware.Principal) (*TOTPEnrollResponse, error) {
+	user, err := s.repo.GetUserByID(ctx, principal.UserID)
+	if err != nil {
+		return nil, apperrors.ErrUnauthorized
+	}
+	if user.MFAEnabled {
+		return nil, errMFAEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации секрета")
+	}
+
+	if err := s.repo.SetPendingTOTP(ctx, user.ID, secret); err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка сохранения секрета")
+	}
+
+	return &TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: totpURI(secret, user.Email),
+	}, nil
+}
+
+// ConfirmTOTP включает 2FA после проверки первого кода и выдаёт коды восстановления.
+// Коды показываются один раз, в БД хранятся только их хеши.
+func (s *Service) ConfirmTOTP(ctx context.Context, principal *middleware.Principal, req TOTPConfirmRequest, client ClientInfo) (*RecoveryCodesResponse, error) {
+	secret, enabled, err := s.repo.GetTOTP(ctx, principal.UserID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки секрета")
+	}
+	if enabled {
+		return nil, errMFAEnabled
+	}
+	if secret == "" {
+		return nil, errMFANotEnrolling
+	}
+
+	if err := s.checkTOTP(ctx, principal.UserID, secret, req.Code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка генерации кодов")
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.repo.EnableTOTP(ctx, principal.UserID, hashes); err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка включения 2FA")
+	}
+	s.recordEvent(ctx, principal.UserID, EventMFAEnable, OutcomeSuccess, client, nil)
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP выключает 2FA; требует пароль и действующий код.
+// Успешное выключение снимает счётчик неудачных кодов
+func (s *Service) DisableTOTP(ctx context.Context, principal *middleware.Principal, req TOTPDisableRequest, client ClientInfo) error {
+	if req.Password == "" || req.Code == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	// Пароль и код подбираются под общими блокировками входа: иначе украденный
+	// токен доступа позволил бы перебирать их здесь и выключить 2FA
+	if err := s.ConfirmPassword(ctx, principal.UserID, principal.Email, req.Password); err != nil {
+		if err == apperrors.ErrInvalidCredentials {
+			s.recordEvent(ctx, principal.UserID, EventMFADisable, OutcomeFailure, client, map[string]any{"reason": "invalid_password"})
+		}
+		return err
+	}
+	if err := s.checkMFALock(ctx, principal.UserID); err != nil {
+		return err
+	}
+
+	secret, enabled, err := s.repo.GetTOTP(ctx, principal.UserID)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка загрузки секрета")
+	}
+	if !enabled {
+		return errMFANotEnabled
+	}
+
+	if err := s.checkSecondFactor(ctx, principal.UserID, secret, req.Code); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			s.recordEvent(ctx, principal.UserID, EventMFADisable, OutcomeFailure, client, map[string]any{"reason": "invalid_code"})
+			if err := s.recordMFAFailure(ctx, principal.UserID); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	if err := s.repo.DisableTOTP(ctx, principal.UserID); err != nil {
+		return apperrors.Wrap(err, "Ошибка выключения 2FA")
+	}
+	s.recordEvent(ctx, principal.UserID, EventMFADisable, OutcomeSuccess, client, nil)
+	if err := s.resetMFAFailures(ctx, principal.UserID); err != nil {
+		log.Printf("Failed to reset MFA failures of user %d: %v", principal.UserID, err)
+	}
+	return nil
+}
+
+// checkSecondFactor принимает либо код из приложения, либо код восстановления
+func (s *Service) checkSecondFactor(ctx context.Context, userID int, secret, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.checkTOTP(ctx, userID, secret, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки кода")
+	}
+	if !used {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// checkTOTP проверяет код и не даёт использовать его повторно
+func (s *Service) checkTOTP(ctx context.Context, userID int, secret, code string) error {
+	step, ok := verifyTOTP(secret, code, time.Now())
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	// Код действителен ещё пару интервалов — запоминаем шаг, чтобы перехваченный код нельзя было повторить
+	fresh, err := s.rdb.SetNX(ctx, fmt.Sprintf("totp_used:%d:%d", userID, step), 1, time.Duration(totpPeriod*(2*totpSkew+1))*time.Second).Result()
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки кода")
+	}
+	if !fresh {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// newRecoveryCode генерирует код вида "abcde-fghij"
+func newRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789" // без похожих символов
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i := range buf {
+		buf[i] = alphabet[int(buf[i])%len(alphabet)]
+	}
+	return string(buf[:5]) + "-" + string(buf[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "time"
+
 type RegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -11,14 +13,183 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// ClientInfo — сведения о клиенте, от которого пришёл запрос
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token,omitempty"` // короткоживущий токен доступа
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int    `json:"expiresIn,omitempty"` // время жизни токена доступа в секундах
+	User         User   `json:"user"`
+	// При включённой 2FA вместо токенов приходит mfaToken,
+	// который нужно обменять на токены через /auth/mfa/verify
+	MFARequired bool   `json:"mfaRequired,omitempty"`
+	MFAToken    string `json:"mfaToken,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 type User struct {
-	ID    int    `json:"id"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	EmailVerified bool   `json:"emailVerified"`
+	MFAEnabled    bool   `json:"mfaEnabled"`
+	Role          string `json:"role"`
+	Disabled      bool   `json:"-"`
+}
+
+type ForgotPasswordRequest struct {
 	Email string `json:"email"`
-	Name  string `json:"name"`
 }
 
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest — смена пароля с подтверждением текущего
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ChangeEmailRequest — смена адреса; новый адрес подтверждается письмом
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"` // для QR-кода в приложении-аутентификаторе
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type TOTPDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // код из приложения или код восстановления
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"` // код из приложения или код восстановления
+}
+
+type OAuthStartResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"` // куда перенаправить пользователя
+}
+
+// OAuthCallbackRequest — параметры, с которыми провайдер вернул пользователя на фронтенд
+type OAuthCallbackRequest struct {
+	Code     string `json:"code"`
+	State    string `json:"state"`
+	DeviceID string `json:"deviceId,omitempty"` // только для VK ID
+}
+
+type OAuthProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// APIKey — персональный ключ без секрета
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // начало ключа, по нему ключ узнают в списке
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+// CreatedAPIKey — ответ на создание ключа; Key показывается один раз
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 — бессрочный
+}
+
+type APIKeyListResponse struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// UserSession — активный вход пользователя с одного устройства
+type UserSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+}
+
+// UserSessionListResponse — ответ со списком сессий
+type UserSessionListResponse struct {
+	Sessions []UserSession `json:"sessions"`
+}
+
+// AuthEvent — событие входа или работы с учётными данными (таблица auth_events)
+type AuthEvent struct {
+	ID        int64          `json:"id"`
+	Type      string         `json:"type"`
+	Outcome   string         `json:"outcome"`
+	IP        string         `json:"ip,omitempty"`
+	UserAgent string         `json:"userAgent,omitempty"`
+	Details   map[string]any `json:"details,omitempty"` // способ входа, провайдер, причина отказа
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// AuthEventListResponse — страница журнала безопасности
+type AuthEventListResponse struct {
+	Events     []AuthEvent `json:"events"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// apiKeyOwner — действующий ключ и его владелец
+type apiKeyOwner struct {
+	KeyID         int
+	UserID        int
+	Email         string
+	EmailVerified bool
+	Scopes        []string
+	ExpiresAt     *time.Time
+}
+
+// Назначение одноразовых токенов в таблице user_tokens
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposeEmailChange       = "email_change"
+)
+
+// refreshToken — запись таблицы refresh_tokens
+type refreshToken struct {
+	UserID    int
+	FamilyID  string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// oauthStateTTL — сколько ждём возврата пользователя от провайдера
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthNonceCookie связывает вход с браузером, который его начал: без этого
+// чужой code и state, подсунутые по ссылке, залогинили бы жертву в аккаунт атакующего
+const OAuthNonceCookie = "oauth_nonce"
+
+var (
+	errOAuthProviderUnknown = apperrors.New(http.StatusNotFound, "Вход через этого провайдера не настроен")
+	errOAuthFailed          = apperrors.New(http.StatusBadGateway, "Не удалось войти через внешний сервис")
+	errOAuthNoEmail         = apperrors.New(http.StatusBadRequest, "Сервис входа не передал email. Разрешите доступ к почте")
+	errOAuthEmailTaken      = apperrors.New(http.StatusConflict, "Аккаунт с этим email уже есть. Войдите по паролю")
+	errOAuthUnverified      = apperrors.New(http.StatusConflict, "Аккаунт с этим email не подтверждён. Восстановите пароль по ссылке из письма и войдите")
+)
+
+// oauthState хранится в Redis между началом входа и возвратом от провайдера
+type oauthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"`
+	NonceHash    string `json:"nonceHash"` // хеш значения cookie OAuthNonceCookie
+}
+
+// matchesNonce сверяет cookie браузера с сохранённым при старте входа значением
+func (st *oauthState) matchesNonce(nonce string) bool {
+	if nonce == "" || st.NonceHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(nonce)), []byte(st.NonceHash)) == 1
+}
+
+func oauthStateKey(state string) string {
+	return "oauth_state:" + state
+}
+
+func (s *Service) oauthProvider(name string) (*OAuthProvider, error) {
+	for i := range s.cfg.OAuthProviders {
+		if s.cfg.OAuthProviders[i].Name == name {
+			return &s.cfg.OAuthProviders[i], nil
+		}
+	}
+	return nil, errOAuthProviderUnknown
+}
+
+// OAuthProviders возвращает имена настроенных провайдеров
+func (s *Service) OAuthProviders() []string {
+	names := make([]string, 0, len(s.cfg.OAuthProviders))
+	for _, p := range s.cfg.OAuthProviders {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// StartOAuth создаёт state и PKCE verifier и возвращает ссылку на страницу провайдера.
+// nonce — значение cookie браузера; CompleteOAuth примет только тот же nonce
+func (s *Service) StartOAuth(ctx context.Context, providerName, nonce string) (*OAuthStartResponse, error) {
+	provider, err := s.oauthProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, _, err := newOpaqueToken()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+	verifier, _, err := newOpaqueToken()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	payload, err := json.Marshal(oauthState{Provider: provider.Name, CodeVerifier: verifier, NonceHash: hashToken(nonce)})
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка сохранения состояния входа")
+	}
+	if err := s.rdb.Set(ctx, oauthStateKey(state), payload, oauthStateTTL).Err(); err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка сохранения состояния входа")
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	return &OAuthStartResponse{
+		AuthorizationURL: provider.authorizationURL(state, base64.RawURLEncoding.EncodeToString(challenge[:])),
+	}, nil
+}
+
+// CompleteOAuth обменивает код от провайдера на токены.
+// Пользователь находится по привязке, по подтверждённому email или создаётся
+func (s *Service) CompleteOAuth(ctx context.Context, providerName string, req OAuthCallbackRequest, nonce string, client ClientInfo) (*AuthResponse, error) {
+	if req.Code == "" || req.State == "" {
+		return nil, apperrors.ErrBadRequest
+	}
+
+	provider, err := s.oauthProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// state одноразовый: GETDEL не даёт повторить обмен
+	raw, err := s.rdb.GetDel(ctx, oauthStateKey(req.State)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки состояния входа")
+	}
+
+	var state oauthState
+	if err := json.Unmarshal(raw, &state); err != nil || state.Provider != provider.Name {
+		return nil, apperrors.ErrInvalidToken
+	}
+	if !state.matchesNonce(nonce) {
+		log.Printf("OAuth %s callback from a browser that did not start the login", provider.Name)
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	accessToken, err := provider.exchangeCode(ctx, req.Code, state.CodeVerifier, req.State, req.DeviceID)
+	if err != nil {
+		log.Printf("OAuth %s code exchange failed: %v", provider.Name, err)
+		return nil, errOAuthFailed
+	}
+
+	info, err := provider.FetchUser(ctx, provider, accessToken)
+	if err != nil || info.Subject == "" {
+		log.Printf("OAuth %s userinfo failed: %v", provider.Name, err)
+		return nil, errOAuthFailed
+	}
+
+	user, err := s.resolveOAuthUser(ctx, provider.Name, info, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, user, client, loginMethodOAuth, provider.Name)
+}
+
+// resolveOAuthUser находит или создаёт пользователя для внешнего аккаунта
+func (s *Service) resolveOAuthUser(ctx context.Context, provider string, info *OAuthUserInfo, client ClientInfo) (*User, error) {
+	user, err := s.repo.GetUserByIdentity(ctx, provider, info.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, errIdentityNotFound) {
+		return nil, apperrors.Wrap(err, "Ошибка поиска пользователя")
+	}
+
+	if info.Email == "" {
+		return nil, errOAuthNoEmail
+	}
+
+	existing, _, err := s.repo.GetUserByEmail(info.Email)
+	if err == nil {
+		if err := canLinkOAuth(existing, info); err != nil {
+			return nil, err
+		}
+		if err := s.repo.LinkIdentity(ctx, existing.ID, provider, info.Subject, info.Email); err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка привязки аккаунта")
+		}
+		return existing, nil
+	}
+
+	user, err = s.repo.CreateOAuthUser(ctx, info.Email, info.Name, info.EmailVerified, provider, info.Subject)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка создания пользователя")
+	}
+	s.recordEvent(ctx, user.ID, EventRegister, OutcomeSuccess, client, loginDetails(loginMethodOAuth, provider, ""))
+	if !user.EmailVerified {
+		go s.sendVerificationEmail(user)
+	}
+	return user, nil
+}
+
+// canLinkOAuth решает, можно ли привязать внешний аккаунт к существующему по email.
+// Адрес должен быть подтверждён провайдером, иначе чужой аккаунт можно было бы захватить,
+// указав его email. И сам аккаунт должен быть подтверждён: неподтверждённый мог
+// зарегистрировать кто угодно со своим паролем, и после привязки он сохранил бы доступ
+func canLinkOAuth(existing *User, info *OAuthUserInfo) error {
+	if !info.EmailVerified {
+		return errOAuthEmailTaken
+	}
+	if !existing.EmailVerified {
+		return errOAuthUnverified
+	}
+	return nil
+}
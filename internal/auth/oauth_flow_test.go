@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// oauthFlow — Service с настоящим кодом OAuth поверх fakeOIDC, miniredis и sqlmock.
+// Ожидаемые запросы к БД перечисляются в тесте по порядку
+type oauthFlow struct {
+	service *Service
+	fake    *fakeOIDC
+	db      sqlmock.Sqlmock
+	redis   *miniredis.Miniredis
+}
+
+var testClient = ClientInfo{IP: "203.0.113.7", UserAgent: "test"}
+
+func newOAuthFlow(t *testing.T, user map[string]any) *oauthFlow {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	keys, err := NewKeyManager("", "", "test-secret-at-least-32-characters-long")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeOIDC(t, user)
+	service := NewService(NewRepository(db), rdb, nil, keys, nil, nil, Config{
+		Issuer:          "finopp-test",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+		OAuthProviders:  []OAuthProvider{fake.provider()},
+	})
+	return &oauthFlow{service: service, fake: fake, db: mock, redis: mr}
+}
+
+// start проходит страницу провайдера и возвращает то, с чем фронтенд придёт в callback
+func (f *oauthFlow) start(t *testing.T, nonce string) OAuthCallbackRequest {
+	t.Helper()
+	resp, err := f.service.StartOAuth(context.Background(), "fake", nonce)
+	if err != nil {
+		t.Fatalf("StartOAuth: %v", err)
+	}
+	code, state := f.fake.authorize(resp.AuthorizationURL)
+	return OAuthCallbackRequest{Code: code, State: state}
+}
+
+func (f *oauthFlow) complete(req OAuthCallbackRequest, nonce string) (*AuthResponse, error) {
+	return f.service.CompleteOAuth(context.Background(), "fake", req, nonce, testClient)
+}
+
+func (f *oauthFlow) assertDB(t *testing.T) {
+	t.Helper()
+	if err := f.db.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Запросы OAuth-входа в порядке выполнения
+var (
+	sqlIdentityLookup = regexp.QuoteMeta(`FROM user_identities i JOIN users u ON u.id = i.user_id`)
+	sqlUserByEmail    = regexp.QuoteMeta(`FROM users WHERE email = $1`)
+	sqlLinkIdentity   = regexp.QuoteMeta(`INSERT INTO user_identities (user_id, provider, subject, email)`)
+	sqlCreateUser     = regexp.QuoteMeta(`INSERT INTO users (email, password_hash, name, email_verified_at)`)
+	sqlCreateSession  = regexp.QuoteMeta(`INSERT INTO user_sessions`)
+	sqlRefreshToken   = regexp.QuoteMeta(`INSERT INTO refresh_tokens`)
+	sqlAuthEvent      = regexp.QuoteMeta(`INSERT INTO auth_events`)
+)
+
+var userByEmailColumns = []string{"id", "email", "name", "verified", "mfa", "role", "disabled", "password_hash"}
+
+func (f *oauthFlow) expectNoIdentity() {
+	f.db.ExpectQuery(sqlIdentityLookup).WithArgs("fake", "42").WillReturnError(sql.ErrNoRows)
+}
+
+func (f *oauthFlow) expectLogin(userID int) {
+	f.db.ExpectBegin()
+	f.db.ExpectExec(sqlCreateSession).WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectExec(sqlRefreshToken).WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectCommit()
+	f.db.ExpectExec(sqlAuthEvent).WithArgs(userID, EventLogin, OutcomeSuccess, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func verifiedOIDCUser() map[string]any {
+	return map[string]any{"sub": "42", "email": "anna@example.com", "email_verified": true, "name": "Анна"}
+}
+
+func TestCompleteOAuthCreatesUserWithIdentity(t *testing.T) {
+	f := newOAuthFlow(t, verifiedOIDCUser())
+	req := f.start(t, "nonce-1")
+
+	f.expectNoIdentity()
+	f.db.ExpectQuery(sqlUserByEmail).WithArgs("anna@example.com").WillReturnError(sql.ErrNoRows)
+	f.db.ExpectBegin()
+	f.db.ExpectQuery(sqlCreateUser).WithArgs("anna@example.com", "Анна", true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "verified", "role"}).
+			AddRow(7, "anna@example.com", "Анна", true, "user"))
+	f.db.ExpectExec(sqlLinkIdentity).WithArgs(7, "fake", "42", "anna@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectCommit()
+	f.db.ExpectExec(sqlAuthEvent).WithArgs(7, EventRegister, OutcomeSuccess, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	f.expectLogin(7)
+
+	resp, err := f.complete(req, "nonce-1")
+	if err != nil {
+		t.Fatalf("CompleteOAuth: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.User.ID != 7 || !resp.User.EmailVerified {
+		t.Fatalf("response = %+v", resp)
+	}
+	f.assertDB(t)
+}
+
+func TestCompleteOAuthLinksVerifiedUser(t *testing.T) {
+	f := newOAuthFlow(t, verifiedOIDCUser())
+	req := f.start(t, "nonce-1")
+
+	f.expectNoIdentity()
+	f.db.ExpectQuery(sqlUserByEmail).WithArgs("anna@example.com").
+		WillReturnRows(sqlmock.NewRows(userByEmailColumns).AddRow(3, "anna@example.com", "Анна", true, false, "user", false, "hash"))
+	f.db.ExpectExec(sqlLinkIdentity).WithArgs(3, "fake", "42", "anna@example.com").WillReturnResult(sqlmock.NewResult(0, 1))
+	f.expectLogin(3)
+
+	resp, err := f.complete(req, "nonce-1")
+	if err != nil {
+		t.Fatalf("CompleteOAuth: %v", err)
+	}
+	if resp.User.ID != 3 || resp.Token == "" {
+		t.Fatalf("response = %+v, want tokens for user 3", resp)
+	}
+	f.assertDB(t)
+}
+
+func TestCompleteOAuthRefusesUnverifiedAccount(t *testing.T) {
+	f := newOAuthFlow(t, verifiedOIDCUser())
+	req := f.start(t, "nonce-1")
+
+	// Аккаунт с этим email мог зарегистрировать кто угодно: привязки и входа нет
+	f.expectNoIdentity()
+	f.db.ExpectQuery(sqlUserByEmail).WithArgs("anna@example.com").
+		WillReturnRows(sqlmock.NewRows(userByEmailColumns).AddRow(3, "anna@example.com", "Чужой", false, false, "user", false, "hash"))
+
+	if _, err := f.complete(req, "nonce-1"); !errors.Is(err, errOAuthUnverified) {
+		t.Fatalf("CompleteOAuth = %v, want errOAuthUnverified", err)
+	}
+	f.assertDB(t)
+}
+
+func TestCompleteOAuthRejectsReusedState(t *testing.T) {
+	f := newOAuthFlow(t, map[string]any{"sub": "42", "email": "anna@example.com", "email_verified": true})
+	req := f.start(t, "nonce-1")
+
+	f.db.ExpectQuery(sqlIdentityLookup).WithArgs("fake", "42").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "name", "verified", "mfa", "role", "disabled"}).
+			AddRow(3, "anna@example.com", "Анна", true, false, "user", false))
+	f.expectLogin(3)
+
+	if _, err := f.complete(req, "nonce-1"); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+	if _, err := f.complete(req, "nonce-1"); err != apperrors.ErrInvalidToken {
+		t.Fatalf("second callback with the same state = %v, want ErrInvalidToken", err)
+	}
+	f.assertDB(t)
+}
+
+func TestCompleteOAuthRejectsNonceMismatch(t *testing.T) {
+	f := newOAuthFlow(t, verifiedOIDCUser())
+
+	// Атакующий начал вход у себя и подсунул жертве ссылку со своими code и state
+	tests := []struct {
+		name  string
+		nonce string
+	}{
+		{"other browser", "victim-nonce"},
+		{"no cookie", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := f.start(t, "attacker-nonce")
+			if _, err := f.complete(req, tt.nonce); err != apperrors.ErrInvalidToken {
+				t.Fatalf("CompleteOAuth = %v, want ErrInvalidToken", err)
+			}
+			if _, ok := f.fake.codes[req.Code]; !ok {
+				t.Fatal("code was exchanged despite the nonce mismatch")
+			}
+			// state погашен и после неудачной попытки
+			if _, err := f.complete(req, "attacker-nonce"); err != apperrors.ErrInvalidToken {
+				t.Fatalf("retry with the right nonce = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+	f.assertDB(t)
+}
+
+func TestCompleteOAuthRejectsExpiredState(t *testing.T) {
+	f := newOAuthFlow(t, verifiedOIDCUser())
+	req := f.start(t, "nonce-1")
+
+	f.redis.FastForward(oauthStateTTL + 1)
+	if _, err := f.complete(req, "nonce-1"); err != apperrors.ErrInvalidToken {
+		t.Fatalf("CompleteOAuth after state expiry = %v, want ErrInvalidToken", err)
+	}
+	f.assertDB(t)
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Провайдеры социального входа
+const (
+	OAuthGoogle = "google"
+	OAuthYandex = "yandex"
+	OAuthVK     = "vk"
+)
+
+var oauthHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// OAuthProvider описывает OAuth2/OIDC провайдера для authorization code + PKCE.
+// Эндпоинты заданы полями, поэтому любой совместимый провайдер (в том числе
+// локальный тестовый issuer) подключается без изменения кода потока
+type OAuthProvider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+	RedirectURL  string
+	// StateInExchange — передавать state при обмене кода (требует VK ID)
+	StateInExchange bool
+	// FetchUser получает профиль пользователя по access token
+	FetchUser func(ctx context.Context, p *OAuthProvider, accessToken string) (*OAuthUserInfo, error)
+}
+
+// OAuthUserInfo — данные пользователя от провайдера
+type OAuthUserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+func oauthRedirectURL(baseURL, provider string) string {
+	return strings.TrimRight(baseURL, "/") + "/oauth/" + provider + "/callback"
+}
+
+// GoogleProvider — вход через Google (OpenID Connect)
+func GoogleProvider(clientID, clientSecret, redirectBaseURL string) OAuthProvider {
+	return OAuthProvider{
+		Name:         OAuthGoogle,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:       []string{"openid", "email", "profile"},
+		RedirectURL:  oauthRedirectURL(redirectBaseURL, OAuthGoogle),
+		FetchUser:    fetchOIDCUserInfo,
+	}
+}
+
+// YandexProvider — вход через Яндекс ID
+func YandexProvider(clientID, clientSecret, redirectBaseURL string) OAuthProvider {
+	return OAuthProvider{
+		Name:         OAuthYandex,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AuthURL:      "https://oauth.yandex.ru/authorize",
+		TokenURL:     "https://oauth.yandex.ru/token",
+		UserInfoURL:  "https://login.yandex.ru/info?format=json",
+		Scopes:       []string{"login:email", "login:info"},
+		RedirectURL:  oauthRedirectURL(redirectBaseURL, OAuthYandex),
+		FetchUser:    fetchYandexUserInfo,
+	}
+}
+
+// VKProvider — вход через VK ID
+func VKProvider(clientID, clientSecret, redirectBaseURL string) OAuthProvider {
+	return OAuthProvider{
+		Name:            OAuthVK,
+		ClientID:        clientID,
+		ClientSecret:    clientSecret,
+		AuthURL:         "https://id.vk.com/authorize",
+		TokenURL:        "https://id.vk.com/oauth2/auth",
+		UserInfoURL:     "https://id.vk.com/oauth2/user_info",
+		Scopes:          []string{"email"},
+		RedirectURL:     oauthRedirectURL(redirectBaseURL, OAuthVK),
+		StateInExchange: true,
+		FetchUser:       fetchVKUserInfo,
+	}
+}
+
+// authorizationURL собирает ссылку на страницу входа провайдера
+func (p *OAuthProvider) authorizationURL(state, codeChallenge string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode()
+}
+
+// exchangeCode обменивает код авторизации на access token
+func (p *OAuthProvider) exchangeCode(ctx context.Context, code, verifier, state, deviceID string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	if p.StateInExchange {
+		form.Set("state", state)
+	}
+	if deviceID != "" {
+		form.Set("device_id", deviceID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var resp struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := doOAuthJSON(req, &resp); err != nil {
+		return "", err
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint: %s %s", resp.Error, resp.ErrorDescription)
+	}
+	return resp.AccessToken, nil
+}
+
+// doOAuthJSON выполняет запрос и разбирает JSON ответ (в том числе тело ошибки)
+func doOAuthJSON(req *http.Request, out any) error {
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: status %d: %w", req.URL.Host, resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s: status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// fetchOIDCUserInfo читает стандартный OIDC userinfo
+func fetchOIDCUserInfo(ctx context.Context, p *OAuthProvider, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := doOAuthJSON(req, &info); err != nil {
+		return nil, err
+	}
+
+	return &OAuthUserInfo{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+	}, nil
+}
+
+// fetchYandexUserInfo читает профиль Яндекс ID. default_email — подтверждённый
+// адрес аккаунта, поэтому считается проверенным
+func fetchYandexUserInfo(ctx context.Context, p *OAuthProvider, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "OAuth "+accessToken)
+
+	var info struct {
+		ID           string `json:"id"`
+		DefaultEmail string `json:"default_email"`
+		RealName     string `json:"real_name"`
+		DisplayName  string `json:"display_name"`
+	}
+	if err := doOAuthJSON(req, &info); err != nil {
+		return nil, err
+	}
+
+	name := info.RealName
+	if name == "" {
+		name = info.DisplayName
+	}
+	return &OAuthUserInfo{
+		Subject:       info.ID,
+		Email:         info.DefaultEmail,
+		EmailVerified: info.DefaultEmail != "",
+		Name:          name,
+	}, nil
+}
+
+// fetchVKUserInfo читает профиль VK ID. VK не сообщает, подтверждён ли email,
+// поэтому адрес считается непроверенным и к существующему аккаунту не привязывается
+func fetchVKUserInfo(ctx context.Context, p *OAuthProvider, accessToken string) (*OAuthUserInfo, error) {
+	form := url.Values{}
+	form.Set("client_id", p.ClientID)
+	form.Set("access_token", accessToken)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.UserInfoURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var info struct {
+		User struct {
+			UserID    json.Number `json:"user_id"`
+			FirstName string      `json:"first_name"`
+			LastName  string      `json:"last_name"`
+			Email     string      `json:"email"`
+		} `json:"user"`
+	}
+	if err := doOAuthJSON(req, &info); err != nil {
+		return nil, err
+	}
+
+	subject := info.User.UserID.String()
+	if _, err := strconv.ParseInt(subject, 10, 64); err != nil {
+		return nil, fmt.Errorf("vk: unexpected user_id %q", subject)
+	}
+	return &OAuthUserInfo{
+		Subject: subject,
+		Email:   info.User.Email,
+		Name:    strings.TrimSpace(info.User.FirstName + " " + info.User.LastName),
+	}, nil
+}
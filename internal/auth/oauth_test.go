@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeOIDC — локальный OIDC-провайдер: выдаёт code под PKCE challenge,
+// проверяет verifier при обмене и отдаёт userinfo по access token
+type fakeOIDC struct {
+	t      *testing.T
+	server *httptest.Server
+	user   map[string]any
+
+	mu    sync.Mutex
+	codes map[string]string // code -> code_challenge
+}
+
+func newFakeOIDC(t *testing.T, user map[string]any) *fakeOIDC {
+	f := &fakeOIDC{t: t, user: user, codes: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/userinfo", f.userinfo)
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeOIDC) provider() OAuthProvider {
+	return OAuthProvider{
+		Name:         "fake",
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		AuthURL:      f.server.URL + "/authorize",
+		TokenURL:     f.server.URL + "/token",
+		UserInfoURL:  f.server.URL + "/userinfo",
+		Scopes:       []string{"openid", "email"},
+		RedirectURL:  "https://app.example/oauth/fake/callback",
+		FetchUser:    fetchOIDCUserInfo,
+	}
+}
+
+// authorize имитирует согласие пользователя на странице провайдера
+func (f *fakeOIDC) authorize(authorizationURL string) (code, state string) {
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		f.t.Fatalf("bad authorization URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		f.t.Fatalf("authorization URL without S256 PKCE: %s", authorizationURL)
+	}
+
+	code = "code-" + q.Get("state")
+	f.mu.Lock()
+	f.codes[code] = q.Get("code_challenge")
+	f.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (f *fakeOIDC) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("client_id") != "client-1" || r.Form.Get("client_secret") != "secret-1" ||
+		r.Form.Get("redirect_uri") != "https://app.example/oauth/fake/callback" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	f.mu.Lock()
+	challenge, ok := f.codes[r.Form.Get("code")]
+	delete(f.codes, r.Form.Get("code"))
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "at-1", "token_type": "Bearer"})
+}
+
+func (f *fakeOIDC) userinfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer at-1" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, f.user)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// pkcePair повторяет то, что делает StartOAuth
+func pkcePair(t *testing.T) (verifier, challenge string) {
+	verifier, _, err := newOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOAuthFakeOIDCFlow(t *testing.T) {
+	fake := newFakeOIDC(t, map[string]any{
+		"sub": "42", "email": "anna@example.com", "email_verified": true, "name": "Анна",
+	})
+	provider := fake.provider()
+	verifier, challenge := pkcePair(t)
+
+	code, state := fake.authorize(provider.authorizationURL("state-1", challenge))
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+
+	accessToken, err := provider.exchangeCode(context.Background(), code, verifier, state, "")
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	info, err := provider.FetchUser(context.Background(), &provider, accessToken)
+	if err != nil {
+		t.Fatalf("FetchUser: %v", err)
+	}
+
+	want := OAuthUserInfo{Subject: "42", Email: "anna@example.com", EmailVerified: true, Name: "Анна"}
+	if *info != want {
+		t.Fatalf("user info = %+v, want %+v", *info, want)
+	}
+}
+
+func TestOAuthFakeOIDCRejectsWrongVerifier(t *testing.T) {
+	fake := newFakeOIDC(t, map[string]any{"sub": "42"})
+	provider := fake.provider()
+	_, challenge := pkcePair(t)
+	otherVerifier, _ := pkcePair(t)
+
+	code, state := fake.authorize(provider.authorizationURL("state-1", challenge))
+	_, err := provider.exchangeCode(context.Background(), code, otherVerifier, state, "")
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("exchangeCode with a foreign verifier: err = %v, want invalid_grant", err)
+	}
+}
+
+func TestOAuthFakeOIDCCodeIsSingleUse(t *testing.T) {
+	fake := newFakeOIDC(t, map[string]any{"sub": "42"})
+	provider := fake.provider()
+	verifier, challenge := pkcePair(t)
+
+	code, state := fake.authorize(provider.authorizationURL("state-1", challenge))
+	if _, err := provider.exchangeCode(context.Background(), code, verifier, state, ""); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+	if _, err := provider.exchangeCode(context.Background(), code, verifier, state, ""); err == nil {
+		t.Fatal("second exchange of the same code succeeded")
+	}
+}
+
+func TestOAuthFakeOIDCUnverifiedEmail(t *testing.T) {
+	fake := newFakeOIDC(t, map[string]any{"sub": "7", "email": "victim@example.com", "email_verified": false})
+	provider := fake.provider()
+	verifier, challenge := pkcePair(t)
+
+	code, state := fake.authorize(provider.authorizationURL("state-1", challenge))
+	accessToken, err := provider.exchangeCode(context.Background(), code, verifier, state, "")
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	info, err := provider.FetchUser(context.Background(), &provider, accessToken)
+	if err != nil {
+		t.Fatalf("FetchUser: %v", err)
+	}
+	if info.EmailVerified {
+		t.Fatal("email_verified=false reported as verified")
+	}
+	if err := canLinkOAuth(&User{ID: 1, EmailVerified: true}, info); !errors.Is(err, errOAuthEmailTaken) {
+		t.Fatalf("canLinkOAuth = %v, want errOAuthEmailTaken", err)
+	}
+}
+
+func TestCanLinkOAuth(t *testing.T) {
+	tests := []struct {
+		name             string
+		accountVerified  bool
+		providerVerified bool
+		want             error
+	}{
+		{"both verified", true, true, nil},
+		{"provider email unverified", true, false, errOAuthEmailTaken},
+		{"account unverified (pre-registered by someone else)", false, true, errOAuthUnverified},
+		{"nothing verified", false, false, errOAuthEmailTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := canLinkOAuth(&User{ID: 1, EmailVerified: tt.accountVerified}, &OAuthUserInfo{EmailVerified: tt.providerVerified})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("canLinkOAuth = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthStateMatchesNonce(t *testing.T) {
+	state := oauthState{Provider: "fake", NonceHash: hashToken("browser-nonce")}
+
+	tests := []struct {
+		name  string
+		state oauthState
+		nonce string
+		want  bool
+	}{
+		{"same browser", state, "browser-nonce", true},
+		{"other browser", state, "attacker-nonce", false},
+		{"no cookie", state, "", false},
+		{"state without nonce", oauthState{Provider: "fake"}, "browser-nonce", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.matchesNonce(tt.nonce); got != tt.want {
+				t.Fatalf("matchesNonce(%q) = %v, want %v", tt.nonce, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOAuthNonceCookie(t *testing.T) {
+	tests := []struct {
+		name     string
+		secure   bool
+		sameSite http.SameSite
+	}{
+		// Фронтенд на servify.digital зовёт API на Render через fetch: нужна SameSite=None
+		{"production", true, http.SameSiteNoneMode},
+		{"development", false, http.SameSiteLaxMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookie := oauthNonceCookie("nonce-1", 600, tt.secure)
+			if !cookie.HttpOnly || cookie.Secure != tt.secure || cookie.SameSite != tt.sameSite {
+				t.Fatalf("cookie flags: HttpOnly=%v Secure=%v SameSite=%v", cookie.HttpOnly, cookie.Secure, cookie.SameSite)
+			}
+			if cookie.Name != OAuthNonceCookie || cookie.Value != "nonce-1" || cookie.Path != "/api/v1/auth/oauth" {
+				t.Fatalf("cookie = %+v", cookie)
+			}
+			if header := cookie.String(); tt.secure && !strings.Contains(header, "Secure; SameSite=None") {
+				t.Fatalf("Set-Cookie = %q, want Secure; SameSite=None", header)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL = time.Hour
+
+	// Не больше passwordResetLimit писем на один адрес за passwordResetWindow
+	passwordResetLimit  = 3
+	passwordResetWindow = time.Hour
+
+	// mailTimeout ограничивает фоновую отправку письма
+	mailTimeout = 30 * time.Second
+)
+
+// ForgotPassword отправляет ссылку для сброса пароля. Ответ не зависит от того,
+// зарегистрирован ли адрес, а письмо уходит в фоне, чтобы время ответа тоже не выдавало его.
+func (s *Service) ForgotPassword(ctx context.Context, req ForgotPasswordRequest) error {
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	limited, _, err := s.hitLimit(ctx, "pwreset_limit:"+email, passwordResetLimit, passwordResetWindow)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки лимита")
+	}
+	if limited {
+		return apperrors.ErrTooManyRequests
+	}
+
+	go s.sendPasswordReset(req.Email)
+	return nil
+}
+
+func (s *Service) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	user, _, err := s.repo.GetUserByEmail(email)
+	if err != nil {
+		return // адрес не зарегистрирован — молча ничего не делаем
+	}
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to generate password reset token: %v", err)
+		return
+	}
+
+	if err := s.repo.CreateUserToken(ctx, user.ID, tokenPurposePasswordReset, tokenHash, "", time.Now().Add(passwordResetTTL)); err != nil {
+		log.Printf("Failed to save password reset token: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(s.cfg.AppBaseURL, "/"), url.QueryEscape(token))
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Восстановление пароля Finopp",
+		Body: fmt.Sprintf(`Здравствуйте!
+
+Мы получили запрос на сброс пароля. Чтобы задать новый пароль, перейдите по ссылке:
+
+%s
+
+Ссылка действует %d минут и сработает только один раз.
+Если вы не запрашивали сброс, просто проигнорируйте это письмо.`, link, int(passwordResetTTL.Minutes())),
+	})
+	if err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+}
+
+// ResetPassword задаёт новый пароль по одноразовому токену из письма
+// и завершает все существующие входы пользователя
+func (s *Service) ResetPassword(ctx context.Context, req ResetPasswordRequest, client ClientInfo) error {
+	if req.Token == "" || req.Password == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	// Пароль проверяется до того, как токен погашен: слабый пароль не должен сжигать ссылку
+	owner, err := s.repo.GetUserTokenOwner(ctx, tokenPurposePasswordReset, hashToken(req.Token))
+	if errors.Is(err, errUserTokenInvalid) {
+		return apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки токена")
+	}
+	if err := s.passwords.Validate(ctx, req.Password, owner.Email, owner.Name); err != nil {
+		return err
+	}
+
+	userID, _, err := s.repo.ConsumeUserToken(ctx, tokenPurposePasswordReset, hashToken(req.Token))
+	if errors.Is(err, errUserTokenInvalid) {
+		return apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки токена")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка хеширования пароля")
+	}
+
+	if err := s.repo.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
+		return apperrors.Wrap(err, "Ошибка смены пароля")
+	}
+
+	if err := s.LogoutEverywhere(ctx, userID); err != nil {
+		return err
+	}
+
+	// Ссылка пришла на этот адрес, пароль задал его владелец, чужие сессии завершены:
+	// теперь аккаунт можно считать подтверждённым (и привязать к нему соцсеть)
+	if err := s.repo.MarkEmailVerified(ctx, userID); err != nil {
+		return apperrors.Wrap(err, "Ошибка подтверждения email")
+	}
+
+	// Сброс пароля снимает блокировку входа после перебора
+	if err := s.resetLoginFailures(ctx, normalizeEmail(owner.Email)); err != nil {
+		return apperrors.Wrap(err, "Ошибка снятия блокировки входа")
+	}
+
+	s.recordEvent(ctx, userID, EventPasswordReset, OutcomeSuccess, client, nil)
+	return nil
+}
+
+// normalizeEmail приводит адрес к виду для ключей лимитов
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// hitLimit увеличивает счётчик key в Redis и сообщает, превышен ли лимит
+// за окно window. Вторым значением возвращает время до сброса счётчика.
+func (s *Service) hitLimit(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	pipe := s.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+
+	return incr.Val() > limit, ttl.Val(), nil
+}
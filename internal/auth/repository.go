@@ -1,8 +1,25 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	errRefreshTokenReused  = errors.New("refresh token reuse detected")
+	errUserTokenInvalid    = errors.New("user token is invalid, used or expired")
+	errIdentityNotFound    = errors.New("identity not found")
+	errAPIKeyNotFound      = errors.New("api key not found, revoked or expired")
+	errSessionNotFound     = errors.New("session not found or already revoked")
+	errEmailTaken          = errors.New("email is already registered")
 )
 
 type Repository struct {
@@ -13,14 +30,38 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// querier — *sql.DB или *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithTx выполняет fn в транзакции и фиксирует её, если fn не вернула ошибку
+func (r *Repository) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (r *Repository) CreateUser(email, passwordHash, name string) (*User, error) {
 	var user User
 	err := r.db.QueryRow(
 		`INSERT INTO users (email, password_hash, name) 
 		 VALUES ($1, $2, $3) 
-		 RETURNING id, email, name`,
+		 RETURNING id, email, name, email_verified_at IS NOT NULL, role`,
 		email, passwordHash, name,
-	).Scan(&user.ID, &user.Email, &user.Name)
+	).Scan(&user.ID, &user.Email, &user.Name, &user.EmailVerified, &user.Role)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -34,9 +75,12 @@ func (r *Repository) GetUserByEmail(email string) (*User, string, error) {
 	var passwordHash string
 
 	err := r.db.QueryRow(
-		`SELECT id, email, name, password_hash FROM users WHERE email = $1`,
+		`SELECT id, email, name, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL,
+		        role, disabled_at IS NOT NULL, password_hash
+		 FROM users WHERE email = $1`,
 		email,
-	).Scan(&user.ID, &user.Email, &user.Name, &passwordHash)
+	).Scan(&user.ID, &user.Email, &user.Name, &user.EmailVerified, &user.MFAEnabled,
+		&user.Role, &user.Disabled, &passwordHash)
 
 	if err == sql.ErrNoRows {
 		return nil, "", fmt.Errorf("user not found")
@@ -58,3 +102,760 @@ func (r *Repository) EmailExists(email string) (bool, error) {
 	return exists, err
 }
 
+
+func (r *Repository) GetUserByID(ctx context.Context, id int) (*User, error) {
+	var user User
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, email, name, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL,
+		        role, disabled_at IS NOT NULL
+		 FROM users WHERE id = $1`,
+		id,
+	).Scan(&user.ID, &user.Email, &user.Name, &user.EmailVerified, &user.MFAEnabled, &user.Role, &user.Disabled)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// CreateSession создаёт сессию (вход с устройства) и первый refresh-токен её семьи;
+// id сессии совпадает с family_id refresh-токенов
+func (r *Repository) CreateSession(ctx context.Context, userID int, sessionID, tokenHash string, client ClientInfo, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_sessions (id, user_id, user_agent, ip, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		sessionID, userID, truncate(client.UserAgent, maxUserAgentLen), client.IP, expiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		userID, sessionID, tokenHash, expiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RotateRefreshToken погашает старый refresh-токен и сохраняет новый в той же семье.
+// Повторное предъявление уже погашенного токена означает его утечку:
+// вся семья отзывается и возвращается errRefreshTokenReused.
+func (r *Repository) RotateRefreshToken(ctx context.Context, oldHash, newHash string, client ClientInfo, expiresAt time.Time) (*refreshToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var token refreshToken
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id, family_id, expires_at, used_at, revoked_at
+		 FROM refresh_tokens WHERE token_hash = $1
+		 FOR UPDATE`,
+		oldHash,
+	).Scan(&token.UserID, &token.FamilyID, &token.ExpiresAt, &usedAt, &revokedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, errRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if revokedAt.Valid {
+		return nil, errRefreshTokenInvalid
+	}
+
+	if usedAt.Valid {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+			 WHERE family_id = $1 AND revoked_at IS NULL`,
+			token.FamilyID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP
+			 WHERE id = $1 AND revoked_at IS NULL`,
+			token.FamilyID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return &token, errRefreshTokenReused
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, errRefreshTokenInvalid
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE token_hash = $1`,
+		oldHash,
+	); err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4)`,
+		token.UserID, token.FamilyID, newHash, expiresAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE user_sessions
+		 SET last_seen_at = CURRENT_TIMESTAMP, ip = $2, user_agent = $3, expires_at = $4
+		 WHERE id = $1`,
+		token.FamilyID, client.IP, truncate(client.UserAgent, maxUserAgentLen), expiresAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	token.ExpiresAt = expiresAt
+	return &token, nil
+}
+
+// RevokeRefreshTokenFamily отзывает семью, к которой относится токен, если он принадлежит пользователю
+func (r *Repository) RevokeRefreshTokenFamily(ctx context.Context, userID int, tokenHash string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE revoked_at IS NULL AND user_id = $1 AND family_id = (
+			SELECT family_id FROM refresh_tokens WHERE token_hash = $2 AND user_id = $1
+		 )`,
+		userID, tokenHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+// ListSessions возвращает действующие сессии пользователя, недавно активные первыми
+func (r *Repository) ListSessions(ctx context.Context, userID int) ([]UserSession, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, last_seen_at
+		 FROM user_sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		 ORDER BY last_seen_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []UserSession{}
+	for rows.Next() {
+		var session UserSession
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession отзывает сессию пользователя и все refresh-токены её семьи
+func (r *Repository) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		sessionID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errSessionNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		sessionID, userID,
+	); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RevokeSessions отзывает все сессии и refresh-токены пользователя, кроме exceptSessionID
+// (пустая строка — все). Возвращает id отозванных сессий
+func (r *Repository) RevokeSessions(ctx context.Context, userID int, exceptSessionID string) ([]string, error) {
+	var revoked []string
+	err := r.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		revoked, err = revokeSessions(ctx, tx, userID, exceptSessionID)
+		return err
+	})
+	return revoked, err
+}
+
+// RevokeSessionsTx — RevokeSessions в транзакции вызывающего
+func (r *Repository) RevokeSessionsTx(ctx context.Context, tx *sql.Tx, userID int, exceptSessionID string) ([]string, error) {
+	return revokeSessions(ctx, tx, userID, exceptSessionID)
+}
+
+func revokeSessions(ctx context.Context, db querier, userID int, exceptSessionID string) ([]string, error) {
+	rows, err := db.QueryContext(ctx,
+		`UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+		 RETURNING id`,
+		userID, exceptSessionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	var revoked []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan session id: %w", err)
+		}
+		revoked = append(revoked, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Токены без сессии (выданные до её появления) тоже отзываются
+	if _, err := db.ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL`,
+		userID, exceptSessionID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return revoked, nil
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	return updatePassword(ctx, r.db, userID, passwordHash)
+}
+
+// UpdatePasswordTx — UpdatePassword в транзакции вызывающего
+func (r *Repository) UpdatePasswordTx(ctx context.Context, tx *sql.Tx, userID int, passwordHash string) error {
+	return updatePassword(ctx, tx, userID, passwordHash)
+}
+
+func updatePassword(ctx context.Context, db querier, userID int, passwordHash string) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		passwordHash, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+// CreateUserToken сохраняет хеш одноразового токена (сброс пароля и т.п.)
+// и, если нужно, связанные с ним данные (например, новый email).
+// Ранее выданные неиспользованные токены с той же целью гасятся.
+func (r *Repository) CreateUserToken(ctx context.Context, userID int, purpose, tokenHash, payload string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		 WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purpose,
+	); err != nil {
+		return fmt.Errorf("failed to invalidate user tokens: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, payload, expires_at)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), $5)`,
+		userID, purpose, tokenHash, payload, expiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to create user token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeUserToken атомарно гасит действующий токен и возвращает id его владельца
+// и сохранённые с токеном данные
+func (r *Repository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (int, string, error) {
+	return consumeUserToken(ctx, r.db, purpose, tokenHash)
+}
+
+// ConsumeUserTokenTx — ConsumeUserToken в транзакции вызывающего: при откате токен
+// остаётся действующим
+func (r *Repository) ConsumeUserTokenTx(ctx context.Context, tx *sql.Tx, purpose, tokenHash string) (int, string, error) {
+	return consumeUserToken(ctx, tx, purpose, tokenHash)
+}
+
+func consumeUserToken(ctx context.Context, db querier, purpose, tokenHash string) (int, string, error) {
+	var userID int
+	var payload string
+	err := db.QueryRowContext(ctx,
+		`UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		 RETURNING user_id, COALESCE(payload, '')`,
+		tokenHash, purpose,
+	).Scan(&userID, &payload)
+
+	if err == sql.ErrNoRows {
+		return 0, "", errUserTokenInvalid
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to consume user token: %w", err)
+	}
+	return userID, payload, nil
+}
+
+// GetUserTokenOwner возвращает владельца действующего токена, не погашая его
+func (r *Repository) GetUserTokenOwner(ctx context.Context, purpose, tokenHash string) (*User, error) {
+	var userID int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id FROM user_tokens
+		 WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`,
+		tokenHash, purpose,
+	).Scan(&userID)
+
+	if err == sql.ErrNoRows {
+		return nil, errUserTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user token: %w", err)
+	}
+	return r.GetUserByID(ctx, userID)
+}
+
+// UpdateEmailTx меняет адрес пользователя; новый адрес подтверждён письмом
+func (r *Repository) UpdateEmailTx(ctx context.Context, tx *sql.Tx, userID int, email string) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE users
+		 SET email = $2, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1`,
+		userID, email,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errEmailTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) MarkEmailVerified(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND email_verified_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	return nil
+}
+
+func (r *Repository) GetPasswordHash(ctx context.Context, userID int) (string, error) {
+	var passwordHash string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT password_hash FROM users WHERE id = $1`,
+		userID,
+	).Scan(&passwordHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get password hash: %w", err)
+	}
+	return passwordHash, nil
+}
+
+// GetTOTP возвращает секрет TOTP (или пустую строку) и признак включённой 2FA
+func (r *Repository) GetTOTP(ctx context.Context, userID int) (string, bool, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1`,
+		userID,
+	).Scan(&secret, &enabled)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get totp: %w", err)
+	}
+	return secret.String, enabled, nil
+}
+
+// SetPendingTOTP сохраняет секрет до подтверждения; для уже включённой 2FA ничего не меняет
+func (r *Repository) SetPendingTOTP(ctx context.Context, userID int, secret string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_enabled_at IS NULL`,
+		secret, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set totp secret: %w", err)
+	}
+	return nil
+}
+
+// EnableTOTP включает 2FA и заменяет коды восстановления
+func (r *Repository) EnableTOTP(ctx context.Context, userID int, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		userID,
+	); err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hash,
+		); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP выключает 2FA и удаляет секрет и коды восстановления
+func (r *Repository) DisableTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		userID,
+	); err != nil {
+		return fmt.Errorf("failed to disable totp: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode гасит код восстановления; false — кода нет или он уже использован
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetUserByIdentity ищет пользователя по привязанному внешнему аккаунту
+func (r *Repository) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	var user User
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT u.id, u.email, u.name, u.email_verified_at IS NOT NULL, u.totp_enabled_at IS NOT NULL,
+		        u.role, u.disabled_at IS NOT NULL
+		 FROM user_identities i JOIN users u ON u.id = i.user_id
+		 WHERE i.provider = $1 AND i.subject = $2`,
+		provider, subject,
+	).Scan(&user.ID, &user.Email, &user.Name, &user.EmailVerified, &user.MFAEnabled, &user.Role, &user.Disabled)
+
+	if err == sql.ErrNoRows {
+		return nil, errIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by identity: %w", err)
+	}
+
+	return &user, nil
+}
+
+// LinkIdentity привязывает внешний аккаунт к пользователю
+func (r *Repository) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (provider, subject) DO NOTHING`,
+		userID, provider, subject, email,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// CreateOAuthUser создаёт пользователя без пароля вместе с привязкой внешнего аккаунта.
+// Пустой password_hash не совпадёт ни с одним паролем; задать пароль можно через сброс
+func (r *Repository) CreateOAuthUser(ctx context.Context, email, name string, emailVerified bool, provider, subject string) (*User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var user User
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO users (email, password_hash, name, email_verified_at)
+		 VALUES ($1, '', $2, CASE WHEN $3 THEN CURRENT_TIMESTAMP END)
+		 RETURNING id, email, name, email_verified_at IS NOT NULL, role`,
+		email, name, emailVerified,
+	).Scan(&user.ID, &user.Email, &user.Name, &user.EmailVerified, &user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`,
+		user.ID, provider, subject, email,
+	); err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// CountActiveAPIKeys считает неотозванные и неистёкшие ключи пользователя
+func (r *Repository) CountActiveAPIKeys(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM api_keys
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		   AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`,
+		userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count api keys: %w", err)
+	}
+	return count, nil
+}
+
+func (r *Repository) CreateAPIKey(ctx context.Context, userID int, name, prefix, keyHash string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	key := APIKey{Name: name, Prefix: prefix, Scopes: scopes, ExpiresAt: expiresAt}
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id, created_at`,
+		userID, name, prefix, keyHash, pq.Array(scopes), expiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListAPIKeys возвращает неотозванные ключи пользователя, новые первыми
+func (r *Repository) ListAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, name, prefix, scopes, created_at, last_used_at, expires_at
+		 FROM api_keys
+		 WHERE user_id = $1 AND revoked_at IS NULL
+		 ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *Repository) RevokeAPIKey(ctx context.Context, userID, keyID int) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errAPIKeyNotFound
+	}
+	return nil
+}
+
+// UseAPIKey находит действующий ключ по хешу и отмечает время использования.
+// last_used_at обновляется не чаще раза в минуту, чтобы не писать в БД на каждый запрос
+func (r *Repository) UseAPIKey(ctx context.Context, keyHash string) (*apiKeyOwner, error) {
+	var owner apiKeyOwner
+	var lastUsedAt sql.NullTime
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT k.id, k.scopes, k.expires_at, k.last_used_at,
+		        u.id, u.email, u.email_verified_at IS NOT NULL
+		 FROM api_keys k JOIN users u ON u.id = k.user_id
+		 WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND u.disabled_at IS NULL
+		   AND (k.expires_at IS NULL OR k.expires_at > CURRENT_TIMESTAMP)`,
+		keyHash,
+	).Scan(&owner.KeyID, pq.Array(&owner.Scopes), &owner.ExpiresAt, &lastUsedAt,
+		&owner.UserID, &owner.Email, &owner.EmailVerified)
+
+	if err == sql.ErrNoRows {
+		return nil, errAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if !lastUsedAt.Valid || time.Since(lastUsedAt.Time) > time.Minute {
+		if _, err := r.db.ExecContext(ctx,
+			`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`,
+			owner.KeyID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to touch api key: %w", err)
+		}
+	}
+
+	return &owner, nil
+}
+
+// RecordAuthEvent сохраняет событие входа; userID 0 — пользователь не найден
+func (r *Repository) RecordAuthEvent(ctx context.Context, userID int, event AuthEvent) error {
+	var details []byte
+	if len(event.Details) > 0 {
+		var err error
+		details, err = json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("failed to encode auth event details: %w", err)
+		}
+	}
+
+	var owner any
+	if userID != 0 {
+		owner = userID
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO auth_events (user_id, event_type, outcome, ip, user_agent, details)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		owner, event.Type, event.Outcome, event.IP, truncate(event.UserAgent, maxUserAgentLen), details,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record auth event: %w", err)
+	}
+	return nil
+}
+
+// ListAuthEvents возвращает события пользователя, новые первыми.
+// cursor — id события, после которого продолжать (0 — с начала)
+func (r *Repository) ListAuthEvents(ctx context.Context, userID int, cursor int64, limit int) ([]AuthEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, event_type, outcome, COALESCE(ip, ''), COALESCE(user_agent, ''), details, created_at
+		 FROM auth_events
+		 WHERE user_id = $1 AND ($2 = 0 OR id < $2)
+		 ORDER BY id DESC
+		 LIMIT $3`,
+		userID, cursor, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AuthEvent{}
+	for rows.Next() {
+		var event AuthEvent
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.Type, &event.Outcome, &event.IP, &event.UserAgent,
+			&details, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &event.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode auth event details: %w", err)
+			}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteAuthEventsBefore удаляет события старше before и возвращает их количество
+func (r *Repository) DeleteAuthEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM auth_events WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete auth events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	// Не режем посреди UTF-8 последовательности
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -1,32 +1,61 @@
 package auth
 
 import (
+	"context"
+	"net/http"
 	"time"
 
+	"github.com/Kir-Khorev/finopp-back/internal/audit"
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	"github.com/Kir-Khorev/finopp-back/internal/passwords"
 	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Config — параметры выпуска токенов и писем
+type Config struct {
+	Issuer          string // iss в токенах; по нему их проверяют другие сервисы
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	AppBaseURL      string // адрес фронтенда для ссылок в письмах
+	OAuthProviders  []OAuthProvider
+	EventRetention  time.Duration // сколько хранить auth_events; 0 — не чистить
+}
+
+var errAccountDisabled = apperrors.New(http.StatusForbidden, "Аккаунт заблокирован. Обратитесь в поддержку")
+
 type Service struct {
 	repo      *Repository
-	jwtSecret string
+	rdb       *redis.Client
+	denylist  *Denylist
+	mailer    mailer.Mailer
+	keys      *KeyManager
+	audit     *audit.Repository
+	passwords *passwords.Policy
+	cfg       Config
 }
 
-func NewService(repo *Repository, jwtSecret string) *Service {
+func NewService(repo *Repository, rdb *redis.Client, mailer mailer.Mailer, keys *KeyManager, audit *audit.Repository, passwords *passwords.Policy, cfg Config) *Service {
 	return &Service{
 		repo:      repo,
-		jwtSecret: jwtSecret,
+		rdb:       rdb,
+		denylist:  NewDenylist(rdb),
+		mailer:    mailer,
+		keys:      keys,
+		audit:     audit,
+		passwords: passwords,
+		cfg:       cfg,
 	}
 }
 
-func (s *Service) Register(req RegisterRequest) (*AuthResponse, error) {
+func (s *Service) Register(ctx context.Context, req RegisterRequest, client ClientInfo) (*AuthResponse, error) {
 	// Валидация
 	if req.Email == "" || req.Password == "" {
 		return nil, apperrors.ErrBadRequest
 	}
-	if len(req.Password) < 6 {
-		return nil, apperrors.ErrWeakPassword
+	if err := s.passwords.Validate(ctx, req.Password, req.Email, req.Name); err != nil {
+		return nil, err
 	}
 
 	// Проверка существования email
@@ -50,55 +79,56 @@ func (s *Service) Register(req RegisterRequest) (*AuthResponse, error) {
 		return nil, apperrors.Wrap(err, "Ошибка создания пользователя")
 	}
 
-	// Генерация токена
-	token, err := s.generateToken(user.ID, user.Email)
-	if err != nil {
-		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
-	}
+	s.recordEvent(ctx, user.ID, EventRegister, OutcomeSuccess, client, loginDetails(loginMethodPassword, "", ""))
+
+	// Письмо для подтверждения адреса уходит в фоне
+	go s.sendVerificationEmail(user)
 
-	return &AuthResponse{
-		Token: token,
-		User:  *user,
-	}, nil
+	// Выдача токенов
+	return s.issueTokens(ctx, user, client)
 }
 
-func (s *Service) Login(req LoginRequest) (*AuthResponse, error) {
+func (s *Service) Login(ctx context.Context, req LoginRequest, client ClientInfo) (*AuthResponse, error) {
 	// Валидация
 	if req.Email == "" || req.Password == "" {
 		return nil, apperrors.ErrBadRequest
 	}
 
-	// Получение пользователя
+	// Блокировка после серии неудачных попыток
+	email := normalizeEmail(req.Email)
+	if err := s.checkLoginLock(ctx, email, client.IP); err != nil {
+		return nil, err
+	}
+
+	// Получение пользователя. Для несуществующего email bcrypt всё равно
+	// выполняется, чтобы время ответа не выдавало наличие аккаунта
 	user, passwordHash, err := s.repo.GetUserByEmail(req.Email)
 	if err != nil {
-		return nil, apperrors.ErrInvalidCredentials
+		passwordHash = string(dummyPasswordHash)
+		user = nil
 	}
 
 	// Проверка пароля
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil || user == nil {
+		userID, reason := 0, "unknown_email"
+		if user != nil {
+			userID, reason = user.ID, "invalid_password"
+		}
+		s.recordEvent(ctx, userID, EventLogin, OutcomeFailure, client, loginDetails(loginMethodPassword, "", reason))
+
+		if err := s.recordLoginFailure(ctx, email, client.IP); err != nil {
+			return nil, err
+		}
 		return nil, apperrors.ErrInvalidCredentials
 	}
 
-	// Генерация токена
-	token, err := s.generateToken(user.ID, user.Email)
-	if err != nil {
-		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	// С 2FA пароль ещё не весь вход: счётчик сбросит VerifyMFA после второго фактора
+	if !user.MFAEnabled {
+		if err := s.resetLoginFailures(ctx, email); err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка сброса счётчика попыток")
+		}
 	}
 
-	return &AuthResponse{
-		Token: token,
-		User:  *user,
-	}, nil
+	// Выдача токенов
+	return s.completeLogin(ctx, user, client, loginMethodPassword, "")
 }
-
-func (s *Service) generateToken(userID int, email string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 дней
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
-}
-
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// maxUserAgentLen — сколько символов User-Agent сохраняем для сессии
+const maxUserAgentLen = 255
+
+var errSessionRequired = apperrors.NewWithDetails(http.StatusConflict, "Текущая сессия не найдена", "Войдите заново, чтобы управлять сессиями")
+
+// ListSessions возвращает активные входы пользователя и отмечает текущий
+func (s *Service) ListSessions(ctx context.Context, principal *middleware.Principal) ([]UserSession, error) {
+	sessions, err := s.repo.ListSessions(ctx, principal.UserID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка получения сессий")
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == principal.SessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает вход на одном устройстве
+func (s *Service) RevokeSession(ctx context.Context, principal *middleware.Principal, sessionID string) error {
+	err := s.revokeSession(ctx, principal.UserID, sessionID)
+	if errors.Is(err, errSessionNotFound) {
+		return apperrors.ErrNotFound
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка завершения сессии")
+	}
+	return nil
+}
+
+// RevokeOtherSessions завершает все входы, кроме текущего
+func (s *Service) RevokeOtherSessions(ctx context.Context, principal *middleware.Principal) error {
+	if principal.SessionID == "" {
+		// Без текущей сессии нечего оставлять — такой токен выдан до появления сессий
+		return errSessionRequired
+	}
+
+	return s.revokeSessionsExcept(ctx, principal.UserID, principal.SessionID)
+}
+
+// revokeSessionsExcept завершает все сессии пользователя, кроме keepSessionID
+func (s *Service) revokeSessionsExcept(ctx context.Context, userID int, keepSessionID string) error {
+	revoked, err := s.repo.RevokeSessions(ctx, userID, keepSessionID)
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка завершения сессий")
+	}
+	s.revokeSessionTokens(ctx, revoked)
+	return nil
+}
+
+// revokeSessionTokens отзывает уже выданные в сессиях токены доступа. Сессии
+// к этому моменту отозваны в БД, поэтому сбой Redis только логируется:
+// токены доживут свой короткий срок, но не обновятся
+func (s *Service) revokeSessionTokens(ctx context.Context, sessionIDs []string) {
+	for _, id := range sessionIDs {
+		if err := s.denylist.RevokeSession(ctx, id, s.cfg.AccessTokenTTL); err != nil {
+			log.Printf("Failed to revoke access tokens of session %s: %v", id, err)
+		}
+	}
+}
+
+// revokeSession отзывает refresh-токены сессии и уже выданные в ней токены доступа
+func (s *Service) revokeSession(ctx context.Context, userID int, sessionID string) error {
+	if err := s.repo.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return s.denylist.RevokeSession(ctx, sessionID, s.cfg.AccessTokenTTL)
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const tokenTypeAccess = "access"
+
+// accessClaims — содержимое токена доступа
+type accessClaims struct {
+	UserID        int      `json:"user_id"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Role          string   `json:"role"`
+	Permissions   []string `json:"perms,omitempty"`
+	Type          string   `json:"typ"`
+	SessionID     string   `json:"sid,omitempty"` // вход (устройство), к которому относится токен
+	jwt.RegisteredClaims
+}
+
+// issueTokens выдаёт пару токенов для нового входа: создаёт сессию (устройство)
+// и новую семью refresh-токенов, id семьи служит id сессии
+func (s *Service) issueTokens(ctx context.Context, user *User, client ClientInfo) (*AuthResponse, error) {
+	if user.Disabled {
+		return nil, errAccountDisabled
+	}
+
+	sessionID, err := randomID()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	refresh, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	if err := s.repo.CreateSession(ctx, user.ID, sessionID, refreshHash, client, time.Now().Add(s.cfg.RefreshTokenTTL)); err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка сохранения токена")
+	}
+
+	return s.authResponse(user, refresh, sessionID)
+}
+
+// authResponse дополняет refresh-токен свежим токеном доступа
+func (s *Service) authResponse(user *User, refresh, sessionID string) (*AuthResponse, error) {
+	token, err := s.generateToken(user, sessionID)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(s.cfg.AccessTokenTTL.Seconds()),
+		User:         *user,
+	}, nil
+}
+
+func (s *Service) generateToken(user *User, sessionID string) (string, error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := accessClaims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Permissions:   middleware.PermissionsFor(user.Role),
+		Type:          tokenTypeAccess,
+		SessionID:     sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+		},
+	}
+
+	return s.keys.Sign(claims)
+}
+
+// VerifyAccessToken реализует middleware.TokenVerifier
+func (s *Service) VerifyAccessToken(ctx context.Context, tokenString string) (*middleware.Principal, error) {
+	var claims accessClaims
+	token, err := s.keys.Parse(tokenString, &claims, jwt.WithIssuer(s.cfg.Issuer), jwt.WithExpirationRequired())
+
+	if err != nil || !token.Valid || claims.Type != tokenTypeAccess || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	revoked, err := s.denylist.IsRevoked(ctx, claims.ID, claims.UserID, claims.SessionID, claims.IssuedAt.Time)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка проверки токена")
+	}
+	if revoked {
+		return nil, apperrors.ErrInvalidToken
+	}
+
+	return &middleware.Principal{
+		UserID:        claims.UserID,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Role:          claims.Role,
+		Permissions:   claims.Permissions,
+		TokenID:       claims.ID,
+		SessionID:     claims.SessionID,
+		ExpiresAt:     claims.ExpiresAt.Time,
+	}, nil
+}
+
+// JWKS возвращает открытые ключи, которыми можно проверить выданные токены
+func (s *Service) JWKS() JWKSet {
+	return s.keys.JWKS()
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов (ротация)
+// и обновляет время последней активности сессии
+func (s *Service) Refresh(ctx context.Context, req RefreshRequest, client ClientInfo) (*AuthResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, apperrors.ErrBadRequest
+	}
+
+	refresh, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка генерации токена")
+	}
+
+	rotated, err := s.repo.RotateRefreshToken(ctx, hashToken(req.RefreshToken), refreshHash, client, time.Now().Add(s.cfg.RefreshTokenTTL))
+	if errors.Is(err, errRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected for user %d, family %s revoked", rotated.UserID, rotated.FamilyID)
+		if err := s.denylist.RevokeSession(ctx, rotated.FamilyID, s.cfg.AccessTokenTTL); err != nil {
+			log.Printf("Failed to revoke session %s: %v", rotated.FamilyID, err)
+		}
+		s.recordEvent(ctx, rotated.UserID, EventRefreshReuse, OutcomeFailure, client, map[string]any{"sessionId": rotated.FamilyID})
+		return nil, apperrors.ErrInvalidToken
+	}
+	if errors.Is(err, errRefreshTokenInvalid) {
+		return nil, apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка обновления токена")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, rotated.UserID)
+	if err != nil {
+		return nil, apperrors.ErrInvalidToken
+	}
+	if user.Disabled {
+		return nil, errAccountDisabled
+	}
+
+	return s.authResponse(user, refresh, rotated.FamilyID)
+}
+
+// Logout завершает текущую сессию: отзывает её refresh-токены и токены доступа.
+// Переданный refresh-токен отзывается тоже (для токенов, выданных до появления сессий)
+func (s *Service) Logout(ctx context.Context, principal *middleware.Principal, req LogoutRequest, client ClientInfo) error {
+	if principal.SessionID != "" {
+		if err := s.revokeSession(ctx, principal.UserID, principal.SessionID); err != nil && !errors.Is(err, errSessionNotFound) {
+			return apperrors.Wrap(err, "Ошибка выхода")
+		}
+	}
+
+	if req.RefreshToken != "" {
+		if err := s.repo.RevokeRefreshTokenFamily(ctx, principal.UserID, hashToken(req.RefreshToken)); err != nil {
+			return apperrors.Wrap(err, "Ошибка выхода")
+		}
+	}
+
+	if err := s.denylist.Revoke(ctx, principal.TokenID, time.Until(principal.ExpiresAt)); err != nil {
+		return apperrors.Wrap(err, "Ошибка выхода")
+	}
+
+	s.recordEvent(ctx, principal.UserID, EventLogout, OutcomeSuccess, client, nil)
+	return nil
+}
+
+// RevokeAccessTokens делает недействительными все выданные токены доступа пользователя.
+// Refresh-токены остаются: клиент получит новый токен с актуальной ролью
+func (s *Service) RevokeAccessTokens(ctx context.Context, userID int) error {
+	if err := s.denylist.RevokeUser(ctx, userID, s.cfg.AccessTokenTTL); err != nil {
+		return apperrors.Wrap(err, "Ошибка отзыва токенов")
+	}
+	return nil
+}
+
+// LogoutEverywhere завершает все входы пользователя: отзывает refresh-токены
+// и уже выданные токены доступа
+func (s *Service) LogoutEverywhere(ctx context.Context, userID int) error {
+	if _, err := s.repo.RevokeSessions(ctx, userID, ""); err != nil {
+		return apperrors.Wrap(err, "Ошибка завершения сессий")
+	}
+	return s.RevokeAccessTokens(ctx, userID)
+}
+
+// newOpaqueToken генерирует случайный токен и его хеш для хранения в БД
+func newOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+// hashToken — SHA-256 от токена; в БД хранится только хеш
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
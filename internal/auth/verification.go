@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Kir-Khorev/finopp-back/internal/mailer"
+	"github.com/Kir-Khorev/finopp-back/internal/middleware"
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	// verificationResendCooldown — минимальный интервал между повторными письмами
+	verificationResendCooldown = time.Minute
+)
+
+var errEmailAlreadyVerified = apperrors.New(409, "Email уже подтверждён")
+
+// VerifyEmail подтверждает адрес по одноразовому токену из письма. Выданные токены
+// доступа ещё несут email_verified=false, поэтому они отзываются: клиент получит 401,
+// обновит токен, и новый возьмёт статус из БД
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return apperrors.ErrBadRequest
+	}
+
+	userID, _, err := s.repo.ConsumeUserToken(ctx, tokenPurposeEmailVerification, hashToken(token))
+	if errors.Is(err, errUserTokenInvalid) {
+		return apperrors.ErrInvalidToken
+	}
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки токена")
+	}
+
+	if err := s.repo.MarkEmailVerified(ctx, userID); err != nil {
+		return apperrors.Wrap(err, "Ошибка подтверждения email")
+	}
+
+	if err := s.RevokeAccessTokens(ctx, userID); err != nil {
+		log.Printf("Failed to revoke access tokens of user %d after email verification: %v", userID, err)
+	}
+	return nil
+}
+
+// ResendVerification повторно отправляет письмо не чаще раза в минуту
+func (s *Service) ResendVerification(ctx context.Context, principal *middleware.Principal) error {
+	user, err := s.repo.GetUserByID(ctx, principal.UserID)
+	if err != nil {
+		return apperrors.ErrUnauthorized
+	}
+	if user.EmailVerified {
+		return errEmailAlreadyVerified
+	}
+
+	ok, err := s.rdb.SetNX(ctx, fmt.Sprintf("verify_resend:%d", user.ID), 1, verificationResendCooldown).Result()
+	if err != nil {
+		return apperrors.Wrap(err, "Ошибка проверки лимита")
+	}
+	if !ok {
+		return apperrors.ErrTooManyRequests
+	}
+
+	go s.sendVerificationEmail(user)
+	return nil
+}
+
+func (s *Service) sendVerificationEmail(user *User) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+	defer cancel()
+
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("Failed to generate verification token: %v", err)
+		return
+	}
+
+	if err := s.repo.CreateUserToken(ctx, user.ID, tokenPurposeEmailVerification, tokenHash, "", time.Now().Add(emailVerificationTTL)); err != nil {
+		log.Printf("Failed to save verification token: %v", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(s.cfg.AppBaseURL, "/"), url.QueryEscape(token))
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Подтвердите email в Finopp",
+		Body: fmt.Sprintf(`Здравствуйте!
+
+Подтвердите, пожалуйста, адрес электронной почты, перейдя по ссылке:
+
+%s
+
+Ссылка действует %d часа. Если вы не регистрировались в Finopp, просто проигнорируйте это письмо.`, link, int(emailVerificationTTL.Hours())),
+	})
+	if err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+}
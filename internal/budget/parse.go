@@ -0,0 +1,327 @@
+package budget
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Период, за который указана сумма
+type Period string
+
+const (
+	PeriodDay     Period = "day"
+	PeriodWeek    Period = "week"
+	PeriodMonth   Period = "month"
+	PeriodQuarter Period = "quarter"
+	PeriodYear    Period = "year"
+)
+
+// monthlyFactor переводит сумму за период в сумму за месяц
+var monthlyFactor = map[Period]float64{
+	PeriodDay:     365.0 / 12,
+	PeriodWeek:    52.0 / 12,
+	PeriodMonth:   1,
+	PeriodQuarter: 1.0 / 3,
+	PeriodYear:    1.0 / 12,
+}
+
+// Amount — сумма, найденная в тексте
+type Amount struct {
+	Label    string  // к чему относится сумма: "зарплата", "ипотека"
+	Value    float64 // с учётом "тыс", "млн", за исходный период
+	Currency string  // RUB, USD, EUR, KZT или AZN
+	Period   Period
+	Source   string // фрагмент текста, из которого взята сумма
+}
+
+// Monthly — сумма в пересчёте на месяц, округлённая до копеек
+func (a Amount) Monthly() float64 {
+	return roundKopecks(a.Value * monthlyFactor[a.Period])
+}
+
+// numberPattern: целое с разрядами через пробел ("32 000") и дробная часть через точку или запятую
+var numberPattern = regexp.MustCompile(`\d+(?:[ \x{00A0}\x{202F}]\d{3})*(?:[.,]\d+)?`)
+
+type token struct {
+	text  string
+	value string
+}
+
+// Множители: "85 тыс", "1,5 млн", "85к". Длинные формы идут раньше коротких
+var multipliers = []token{
+	{"миллиарда", "1e9"}, {"миллиардов", "1e9"}, {"миллиард", "1e9"}, {"млрд.", "1e9"}, {"млрд", "1e9"},
+	{"миллиона", "1e6"}, {"миллионов", "1e6"}, {"миллион", "1e6"}, {"млн.", "1e6"}, {"млн", "1e6"}, {"лям", "1e6"},
+	{"тысячи", "1e3"}, {"тысяча", "1e3"}, {"тысяч", "1e3"}, {"тыщ", "1e3"}, {"тыс.", "1e3"}, {"тыс", "1e3"},
+	{"т.р.", "1e3"}, {"т. р.", "1e3"}, {"т.р", "1e3"}, {"тр.", "1e3"}, {"тр", "1e3"}, {"к", "1e3"}, {"k", "1e3"},
+}
+
+// attachedOnly — токены, которые считаются только слитно с числом: "85к", но не "85 к отпуску"
+var attachedOnly = map[string]bool{"к": true, "k": true}
+
+// Обозначения валют после числа
+var currencySuffixes = []token{
+	{"рублей", "RUB"}, {"рубля", "RUB"}, {"рубль", "RUB"}, {"руб.", "RUB"}, {"руб", "RUB"}, {"р.", "RUB"}, {"р", "RUB"},
+	{"₽", "RUB"}, {"rub", "RUB"},
+	{"долларов", "USD"}, {"доллара", "USD"}, {"доллар", "USD"}, {"долл.", "USD"}, {"долл", "USD"}, {"баксов", "USD"}, {"$", "USD"}, {"usd", "USD"},
+	{"евро", "EUR"}, {"€", "EUR"}, {"eur", "EUR"},
+	{"тенге", "KZT"}, {"тг", "KZT"}, {"₸", "KZT"}, {"kzt", "KZT"},
+	{"манатов", "AZN"}, {"маната", "AZN"}, {"манат", "AZN"}, {"₼", "AZN"}, {"azn", "AZN"},
+}
+
+// Знаки валют, которые пишут перед числом: "$500"
+var currencyPrefixes = map[rune]string{'₽': "RUB", '$': "USD", '€': "EUR", '₸': "KZT", '₼': "AZN"}
+
+// Слова, задающие период. Побеждает ближайшее к сумме
+var periodWords = []struct {
+	text   string
+	period Period
+}{
+	{"ежедневно", PeriodDay}, {"в день", PeriodDay}, {"за день", PeriodDay}, {"/день", PeriodDay}, {"/дн", PeriodDay}, {"в сутки", PeriodDay},
+	{"еженедельно", PeriodWeek}, {"недел", PeriodWeek}, {"/нед", PeriodWeek},
+	{"ежемесячно", PeriodMonth}, {"мес", PeriodMonth},
+	{"ежеквартально", PeriodQuarter}, {"квартал", PeriodQuarter},
+	{"ежегодно", PeriodYear}, {"в год", PeriodYear}, {"за год", PeriodYear}, {"/год", PeriodYear}, {"годов", PeriodYear}, {"в году", PeriodYear},
+}
+
+// minBareAmount: число без валюты и множителя меньше этого — скорее количество
+// ("2 детей", "35 лет"), а не деньги
+const minBareAmount = 100
+
+// Parse находит в тексте суммы денег. Суммы без явного периода считаются месячными,
+// без валюты — рублёвыми. Проценты, годы и мелкие числа без единиц пропускаются
+func Parse(text string) []Amount {
+	var amounts []Amount
+	for _, fragment := range splitFragments(strings.ToLower(text)) {
+		amounts = append(amounts, parseFragment(fragment)...)
+	}
+	return amounts
+}
+
+// splitFragments режет текст на перечисления. Запятая между цифрами — десятичная
+// ("1,5 млн"), остальные запятые, точки с запятой и переводы строк разделяют статьи
+func splitFragments(text string) []string {
+	var fragments []string
+	start := 0
+	for i, r := range text {
+		switch r {
+		case '\n', ';':
+		case ',':
+			if isDigitAt(text, i-1) && isDigitAt(text, i+1) {
+				continue
+			}
+		default:
+			continue
+		}
+		fragments = append(fragments, text[start:i])
+		start = i + utf8.RuneLen(r)
+	}
+	return append(fragments, text[start:])
+}
+
+func isDigitAt(s string, i int) bool {
+	return i >= 0 && i < len(s) && s[i] >= '0' && s[i] <= '9'
+}
+
+// match — распознанная сумма и её положение во фрагменте
+type match struct {
+	start, end int // число вместе с множителем и валютой
+	amount     Amount
+}
+
+func parseFragment(fragment string) []Amount {
+	var matches []match
+	for _, loc := range numberPattern.FindAllStringIndex(fragment, -1) {
+		if m, ok := parseMatch(fragment, loc[0], loc[1]); ok {
+			matches = append(matches, m)
+		}
+	}
+
+	amounts := make([]Amount, 0, len(matches))
+	for i, m := range matches {
+		// Подпись ищем до суммы (после предыдущей), период — сначала после неё
+		before := 0
+		if i > 0 {
+			before = matches[i-1].end
+		}
+		after := len(fragment)
+		if i+1 < len(matches) {
+			after = matches[i+1].start
+		}
+		head, tail := fragment[before:m.start], fragment[m.end:after]
+
+		m.amount.Period = PeriodMonth
+		if p, ok := findPeriod(tail); ok {
+			m.amount.Period = p
+		} else if p, ok := findPeriod(head); ok {
+			m.amount.Period = p
+		}
+
+		m.amount.Label = cleanLabel(head)
+		if m.amount.Label == "" {
+			m.amount.Label = cleanLabel(tail)
+		}
+		// Хвост после последней суммы тоже её: "85к зарплата"
+		end := m.end
+		if i == len(matches)-1 {
+			end = after
+		}
+		m.amount.Source = strings.TrimSpace(fragment[before:end])
+		amounts = append(amounts, m.amount)
+	}
+	return amounts
+}
+
+// parseMatch разбирает число с окружающими его множителем и валютой
+func parseMatch(fragment string, start, end int) (match, bool) {
+	// Число внутри слова или идентификатора ("ндфл13", "2-комнатная") — не сумма
+	if r, _ := utf8.DecodeLastRuneInString(fragment[:start]); unicode.IsLetter(r) {
+		return match{}, false
+	}
+	if strings.HasPrefix(fragment[end:], "-") {
+		return match{}, false
+	}
+
+	raw := fragment[start:end]
+	m := match{start: start, end: end, amount: Amount{Currency: "RUB"}}
+
+	multiplier := 1.0
+	pos := end
+	if tok, next, ok := matchToken(fragment, pos, multipliers); ok {
+		multiplier, _ = strconv.ParseFloat(tok.value, 64)
+		pos = next
+	}
+
+	hasCurrency := false
+	if r, size := utf8.DecodeLastRuneInString(fragment[:start]); size > 0 {
+		if code, ok := currencyPrefixes[r]; ok {
+			m.amount.Currency, hasCurrency = code, true
+			m.start -= size
+		}
+	}
+	if tok, next, ok := matchToken(fragment, pos, currencySuffixes); ok {
+		m.amount.Currency, hasCurrency = tok.value, true
+		pos = next
+	}
+	m.end = pos
+
+	rest := strings.TrimLeft(fragment[m.end:], " ")
+	if strings.HasPrefix(rest, "%") || strings.HasPrefix(rest, "процент") {
+		return match{}, false
+	}
+
+	value, ok := parseNumber(raw, multiplier != 1)
+	if !ok {
+		return match{}, false
+	}
+
+	if multiplier == 1 && !hasCurrency {
+		if value < minBareAmount {
+			return match{}, false
+		}
+		// "в 2024 году", "с 2019 г."
+		if value >= 1900 && value <= 2100 && value == float64(int(value)) && strings.HasPrefix(rest, "г") {
+			return match{}, false
+		}
+	}
+
+	m.amount.Value = roundKopecks(value * multiplier)
+	return m, true
+}
+
+// matchToken пробует токены по порядку начиная с pos (пробелы пропускаются).
+// Токен, за которым сразу идёт буква, не подходит: "к" не должно съедать начало слова "кредит"
+func matchToken(s string, pos int, tokens []token) (token, int, bool) {
+	i := pos
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	for _, tok := range tokens {
+		if !strings.HasPrefix(s[i:], tok.text) {
+			continue
+		}
+		if attachedOnly[tok.text] && i != pos {
+			continue
+		}
+		next := i + len(tok.text)
+		if r, _ := utf8.DecodeRuneInString(s[next:]); unicode.IsLetter(r) {
+			continue
+		}
+		return tok, next, true
+	}
+	return token{}, pos, false
+}
+
+// parseNumber понимает "32 000", "1,5", "1.5" и "1.500". Три цифры после
+// разделителя без множителя — это разряды ("1.500 руб"), а не дробь
+func parseNumber(raw string, hasMultiplier bool) (float64, bool) {
+	digits := strings.NewReplacer(" ", "", " ", "", " ", "").Replace(raw)
+	if i := strings.LastIndexAny(digits, ".,"); i >= 0 {
+		if len(digits)-i-1 == 3 && !hasMultiplier {
+			digits = digits[:i] + digits[i+1:]
+		} else {
+			digits = digits[:i] + "." + digits[i+1:]
+		}
+	}
+	value, err := strconv.ParseFloat(digits, 64)
+	return value, err == nil
+}
+
+// findPeriod возвращает период, слово которого встречается в тексте раньше других
+func findPeriod(text string) (Period, bool) {
+	best, found := -1, Period("")
+	for _, w := range periodWords {
+		if i := strings.Index(text, w.text); i >= 0 && (best < 0 || i < best) {
+			best, found = i, w.period
+		}
+	}
+	return found, best >= 0
+}
+
+// Служебные слова, которые не нужны в подписи статьи
+var labelNoise = []string{
+	"ежедневно", "еженедельно", "ежемесячно", "ежеквартально", "ежегодно",
+	"в месяц", "в мес.", "в мес", "/мес.", "/мес", "в неделю", "/нед", "в день", "/день", "в год", "/год", "за год", "в квартал",
+}
+
+// yearWords остаются от пропущенного года: "в 2024 году", "с 2019 г."
+var yearWords = map[string]bool{"г": true, "год": true, "года": true, "году": true}
+
+// cleanLabel убирает из подписи периоды, предлоги по краям и знаки препинания
+func cleanLabel(text string) string {
+	for _, noise := range labelNoise {
+		text = strings.ReplaceAll(text, noise, " ")
+	}
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(":—–-+=()/.", r)
+	})
+
+	// Пропущенные числа ("под 12%", "2 детей") и слова при годах ("в 2024 году") в подписи не нужны
+	kept := words[:0]
+	for _, w := range words {
+		if !strings.ContainsAny(w, "0123456789") && !yearWords[w] {
+			kept = append(kept, w)
+		}
+	}
+	words = kept
+
+	edge := map[string]bool{"и": true, "а": true, "с": true, "ещё": true, "еще": true, "по": true, "на": true, "в": true, "за": true, "под": true, "около": true, "примерно": true}
+	for len(words) > 0 && edge[words[0]] {
+		words = words[1:]
+	}
+	for len(words) > 0 && edge[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+func roundKopecks(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,119 @@
+package budget
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Amount // Source не сравнивается
+	}{
+		// Множители и форматы чисел
+		{"тыс", "зарплата 85 тыс", []Amount{{Label: "зарплата", Value: 85000, Currency: "RUB", Period: PeriodMonth}}},
+		{"тыс. с точкой", "аренда 40 тыс. руб", []Amount{{Label: "аренда", Value: 40000, Currency: "RUB", Period: PeriodMonth}}},
+		{"к слитно", "85к зарплата", []Amount{{Label: "зарплата", Value: 85000, Currency: "RUB", Period: PeriodMonth}}},
+		{"k латиницей", "фриланс 20k", []Amount{{Label: "фриланс", Value: 20000, Currency: "RUB", Period: PeriodMonth}}},
+		{"млн с запятой", "ипотека 1,5 млн в год", []Amount{{Label: "ипотека", Value: 1500000, Currency: "RUB", Period: PeriodYear}}},
+		{"млн с точкой", "бонус 1.2 млн ежегодно", []Amount{{Label: "бонус", Value: 1200000, Currency: "RUB", Period: PeriodYear}}},
+		{"разряды через пробел и ₽/мес", "коммуналка 32 000 ₽/мес", []Amount{{Label: "коммуналка", Value: 32000, Currency: "RUB", Period: PeriodMonth}}},
+		{"неразрывный пробел", "еда 15\u00a0500 руб", []Amount{{Label: "еда", Value: 15500, Currency: "RUB", Period: PeriodMonth}}},
+		{"разряды через точку", "кредит 1.500 руб", []Amount{{Label: "кредит", Value: 1500, Currency: "RUB", Period: PeriodMonth}}},
+		{"копейки", "подписка 299,90 руб", []Amount{{Label: "подписка", Value: 299.9, Currency: "RUB", Period: PeriodMonth}}},
+		{"т.р.", "кружки 12 т.р.", []Amount{{Label: "кружки", Value: 12000, Currency: "RUB", Period: PeriodMonth}}},
+		{"число без единиц", "аренда 45000", []Amount{{Label: "аренда", Value: 45000, Currency: "RUB", Period: PeriodMonth}}},
+
+		// Валюты
+		{"$ перед числом", "$500 фриланс", []Amount{{Label: "фриланс", Value: 500, Currency: "USD", Period: PeriodMonth}}},
+		{"доллары словом", "подработка 300 долларов", []Amount{{Label: "подработка", Value: 300, Currency: "USD", Period: PeriodMonth}}},
+		{"евро", "сдаю квартиру за 700 €", []Amount{{Label: "сдаю квартиру", Value: 700, Currency: "EUR", Period: PeriodMonth}}},
+		{"тенге с множителем", "зарплата 400 тыс тенге", []Amount{{Label: "зарплата", Value: 400000, Currency: "KZT", Period: PeriodMonth}}},
+
+		// Периоды
+		{"в неделю", "продукты 5 тыс в неделю", []Amount{{Label: "продукты", Value: 5000, Currency: "RUB", Period: PeriodWeek}}},
+		{"еженедельно перед суммой", "еженедельно на бензин 3000", []Amount{{Label: "бензин", Value: 3000, Currency: "RUB", Period: PeriodWeek}}},
+		{"/нед", "такси 2к/нед", []Amount{{Label: "такси", Value: 2000, Currency: "RUB", Period: PeriodWeek}}},
+		{"в год", "страховка 24 тыс в год", []Amount{{Label: "страховка", Value: 24000, Currency: "RUB", Period: PeriodYear}}},
+		{"ежегодно", "налог на имущество 12000 ежегодно", []Amount{{Label: "налог на имущество", Value: 12000, Currency: "RUB", Period: PeriodYear}}},
+		{"в день", "обеды 500 руб в день", []Amount{{Label: "обеды", Value: 500, Currency: "RUB", Period: PeriodDay}}},
+		{"квартал", "премия 60 тыс раз в квартал", []Amount{{Label: "премия", Value: 60000, Currency: "RUB", Period: PeriodQuarter}}},
+
+		// Что суммой не является
+		{"процент пропускается", "ипотека 30 тыс под 12%", []Amount{{Label: "ипотека", Value: 30000, Currency: "RUB", Period: PeriodMonth}}},
+		{"процент словом", "вклад 8 процентов", nil},
+		{"дробный процент", "ставка 16,5 %", nil},
+		{"год пропускается", "в 2024 году зарплата 90 тыс", []Amount{{Label: "зарплата", Value: 90000, Currency: "RUB", Period: PeriodMonth}}},
+		{"год с г.", "с 2019 г. плачу ипотеку 35 тыс", []Amount{{Label: "плачу ипотеку", Value: 35000, Currency: "RUB", Period: PeriodMonth}}},
+		{"количество детей", "2 детей, на садик 8 тыс", []Amount{{Label: "садик", Value: 8000, Currency: "RUB", Period: PeriodMonth}}},
+		{"возраст", "мне 35 лет", nil},
+		{"число внутри слова", "ндфл13 и ещё mp3", nil},
+		{"число через дефис", "2-комнатная квартира, аренда 40 тыс", []Amount{{Label: "аренда", Value: 40000, Currency: "RUB", Period: PeriodMonth}}},
+		{"к перед словом", "откладываю 500 к отпуску", []Amount{{Label: "откладываю", Value: 500, Currency: "RUB", Period: PeriodMonth}}},
+		{"к не съедает слово", "150 кредит", []Amount{{Label: "кредит", Value: 150, Currency: "RUB", Period: PeriodMonth}}},
+		{"нет сумм", "пока без работы", nil},
+
+		// Несколько статей
+		{"перечисление через запятую", "аренда 40 тыс, еда 50 тыс; связь 1 000 руб", []Amount{
+			{Label: "аренда", Value: 40000, Currency: "RUB", Period: PeriodMonth},
+			{Label: "еда", Value: 50000, Currency: "RUB", Period: PeriodMonth},
+			{Label: "связь", Value: 1000, Currency: "RUB", Period: PeriodMonth},
+		}},
+		{"несколько сумм в одной статье", "зарплата 80 тыс и аванс 20 тыс", []Amount{
+			{Label: "зарплата", Value: 80000, Currency: "RUB", Period: PeriodMonth},
+			{Label: "аванс", Value: 20000, Currency: "RUB", Period: PeriodMonth},
+		}},
+		{"строки", "Зарплата: 120 000 ₽\nБонус: $1000 в год", []Amount{
+			{Label: "зарплата", Value: 120000, Currency: "RUB", Period: PeriodMonth},
+			{Label: "бонус", Value: 1000, Currency: "USD", Period: PeriodYear},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) = %+v, want %d amounts", tt.text, got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				g.Source = ""
+				if g != want {
+					t.Errorf("Parse(%q)[%d] = %+v, want %+v", tt.text, i, g, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	got := Parse("аренда 40 тыс руб, 85к зарплата")
+	want := []string{"аренда 40 тыс руб", "85к зарплата"}
+	if len(got) != len(want) {
+		t.Fatalf("Parse = %+v, want %d amounts", got, len(want))
+	}
+	for i, source := range want {
+		if got[i].Source != source {
+			t.Errorf("Source[%d] = %q, want %q", i, got[i].Source, source)
+		}
+	}
+}
+
+func TestAmountMonthly(t *testing.T) {
+	tests := []struct {
+		period Period
+		value  float64
+		want   float64
+	}{
+		{PeriodDay, 500, 15208.33},
+		{PeriodWeek, 5000, 21666.67},
+		{PeriodMonth, 85000, 85000},
+		{PeriodQuarter, 60000, 20000},
+		{PeriodYear, 24000, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.period), func(t *testing.T) {
+			if got := (Amount{Value: tt.value, Period: tt.period}).Monthly(); got != tt.want {
+				t.Fatalf("Monthly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
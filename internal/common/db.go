@@ -59,6 +59,46 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to create users table: %w", err)
 	}
 
+	// Email verification. Accounts created before verification existed are
+	// treated as verified, so the column is backfilled only when it is added.
+	var hasVerifiedColumn bool
+	err = db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'users' AND column_name = 'email_verified_at'
+		)
+	`).Scan(&hasVerifiedColumn)
+	if err != nil {
+		return fmt.Errorf("failed to inspect users table: %w", err)
+	}
+	if !hasVerifiedColumn {
+		_, err = db.Exec(`
+			ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+			UPDATE users SET email_verified_at = created_at
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to add users.email_verified_at: %w", err)
+		}
+	}
+
+	// TOTP two-factor authentication
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to add users totp columns: %w", err)
+	}
+
+	// Roles and account blocking
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to add users role columns: %w", err)
+	}
+
 	// Profiles table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS profiles (
@@ -77,6 +117,26 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to create profiles table: %w", err)
 	}
 
+	// profiles.updated_at is the optimistic-locking version echoed by clients,
+	// so it must not depend on the session time zone
+	var profilesUpdatedAtType string
+	err = db.QueryRow(`
+		SELECT data_type FROM information_schema.columns
+		WHERE table_name = 'profiles' AND column_name = 'updated_at'
+	`).Scan(&profilesUpdatedAtType)
+	if err != nil {
+		return fmt.Errorf("failed to inspect profiles table: %w", err)
+	}
+	if profilesUpdatedAtType != "timestamp with time zone" {
+		_, err = db.Exec(`
+			ALTER TABLE profiles ALTER COLUMN updated_at TYPE TIMESTAMPTZ;
+			ALTER TABLE profiles ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to convert profiles.updated_at to timestamptz: %w", err)
+		}
+	}
+
 	// Advice sessions table
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS advice_sessions (
@@ -105,7 +165,229 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to create advice_messages table: %w", err)
 	}
 
+	// Indexes for session history lookups
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_advice_sessions_user_id ON advice_sessions(user_id, id DESC);
+		CREATE INDEX IF NOT EXISTS idx_advice_messages_session_id ON advice_messages(session_id, id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create advice indexes: %w", err)
+	}
+
+	// Refresh tokens table (only SHA-256 hashes are stored)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			family_id VARCHAR(64) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMP,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh_tokens table: %w", err)
+	}
+
+	// Sessions (one per login/device); id equals the refresh token family_id
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_sessions (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent VARCHAR(255),
+			ip VARCHAR(64),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ NOT NULL,
+			revoked_at TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create user_sessions table: %w", err)
+	}
+
+	// One-time user tokens (password reset etc.), only hashes are stored
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			purpose VARCHAR(50) NOT NULL,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_tokens_user_purpose ON user_tokens(user_id, purpose);
+		ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS payload TEXT
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create user_tokens table: %w", err)
+	}
+
+	// MFA recovery codes, only hashes are stored
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create mfa_recovery_codes table: %w", err)
+	}
+
+	// External accounts (Google, Yandex, VK ID) linked to users
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			provider VARCHAR(50) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			email VARCHAR(255),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (provider, subject)
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create user_identities table: %w", err)
+	}
+
+	// Personal API keys, only hashes are stored
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash VARCHAR(64) UNIQUE NOT NULL,
+			scopes TEXT[] NOT NULL DEFAULT '{}',
+			last_used_at TIMESTAMP,
+			expires_at TIMESTAMPTZ,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create api_keys table: %w", err)
+	}
+
+	// Audit log of privileged actions (admin API, account changes)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id SERIAL PRIMARY KEY,
+			actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			action VARCHAR(100) NOT NULL,
+			target_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			ip VARCHAR(64),
+			details JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_target_user_id ON audit_log(target_user_id, id DESC)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create audit_log table: %w", err)
+	}
+
+	// Account deletion: the account is purged after a grace period,
+	// only a tombstone with the email hash is kept
+	_, err = db.Exec(`
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ;
+		CREATE TABLE IF NOT EXISTS deleted_users (
+			user_id INTEGER PRIMARY KEY,
+			email_hash VARCHAR(64) NOT NULL,
+			registered_at TIMESTAMP,
+			deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to add account deletion tables: %w", err)
+	}
+
+	// Personal data exports (ZIP archives), kept until expires_at
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS data_exports (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			archive BYTEA,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP,
+			expires_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports(user_id, id DESC)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create data_exports table: %w", err)
+	}
+
+	// Authentication events (logins, failures, token reuse) shown to the user;
+	// failed logins for unknown emails are kept without user_id
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS auth_events (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			event_type VARCHAR(50) NOT NULL,
+			outcome VARCHAR(20) NOT NULL,
+			ip VARCHAR(64),
+			user_agent VARCHAR(255),
+			details JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_auth_events_user_id ON auth_events(user_id, id DESC);
+		CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON auth_events(created_at)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create auth_events table: %w", err)
+	}
+
+	// Expiry and deadline columns are written from Go and compared both in Go and
+	// with CURRENT_TIMESTAMP, so like profiles.updated_at they must not depend on
+	// the session time zone. Tables created before this change are converted
+	for _, column := range []struct{ table, name string }{
+		{"refresh_tokens", "expires_at"},
+		{"user_sessions", "expires_at"},
+		{"user_tokens", "expires_at"},
+		{"api_keys", "expires_at"},
+		{"data_exports", "expires_at"},
+		{"users", "deletion_scheduled_at"},
+	} {
+		if err := convertToTimestamptz(db, column.table, column.name); err != nil {
+			return err
+		}
+	}
+
 	log.Println("✅ Migrations completed")
 	return nil
 }
 
+// convertToTimestamptz changes a TIMESTAMP column to TIMESTAMPTZ unless it already is one
+func convertToTimestamptz(db *sql.DB, table, column string) error {
+	var dataType string
+	err := db.QueryRow(`
+		SELECT data_type FROM information_schema.columns
+		WHERE table_name = $1 AND column_name = $2
+	`, table, column).Scan(&dataType)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s.%s: %w", table, column, err)
+	}
+	if dataType == "timestamp with time zone" {
+		return nil
+	}
+
+	// Names come from the list above, not from input
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE TIMESTAMPTZ`, table, column))
+	if err != nil {
+		return fmt.Errorf("failed to convert %s.%s to timestamptz: %w", table, column, err)
+	}
+	return nil
+}
+
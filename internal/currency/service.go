@@ -10,10 +10,15 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+const fixerBaseURL = "http://data.fixer.io/api"
+
 type Service struct {
 	apiKey      string
+	baseURL     string
 	redisClient *redis.Client
 	httpClient  *http.Client
+	// timeout ограничивает запрос курса к Fixer.io; по его истечении берётся запасной курс
+	timeout time.Duration
 }
 
 type FixerResponse struct {
@@ -35,13 +40,13 @@ type FixerInfo struct {
 	Rate      float64 `json:"rate"`
 }
 
-func NewService(apiKey string, redisClient *redis.Client) *Service {
+func NewService(apiKey string, redisClient *redis.Client, timeout time.Duration) *Service {
 	return &Service{
 		apiKey:      apiKey,
+		baseURL:     fixerBaseURL,
 		redisClient: redisClient,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		httpClient:  &http.Client{},
+		timeout:     timeout,
 	}
 }
 
@@ -59,7 +64,7 @@ func (s *Service) ConvertToRUB(ctx context.Context, amount float64, fromCurrency
 	}
 
 	// Запрашиваем курс у Fixer.io
-	rate, err := s.getExchangeRate(fromCurrency, "RUB")
+	rate, err := s.getExchangeRate(ctx, fromCurrency, "RUB")
 	if err != nil {
 		return 0, fmt.Errorf("failed to get exchange rate: %w", err)
 	}
@@ -70,19 +75,35 @@ func (s *Service) ConvertToRUB(ctx context.Context, amount float64, fromCurrency
 	return amount * rate, nil
 }
 
-// getExchangeRate получает курс конвертации через Fixer.io
-func (s *Service) getExchangeRate(from, to string) (float64, error) {
+// getExchangeRate получает курс конвертации через Fixer.io.
+// Отмена ctx (клиент ушёл или истёк бюджет запроса) возвращается ошибкой, а не запасным курсом
+func (s *Service) getExchangeRate(ctx context.Context, from, to string) (float64, error) {
 	// Если API ключ не задан - используем fallback курсы
 	if s.apiKey == "" {
 		return s.getFallbackRate(from, to), nil
 	}
 
-	url := fmt.Sprintf("http://data.fixer.io/api/latest?access_key=%s&base=%s&symbols=%s",
-		s.apiKey, from, to)
+	url := fmt.Sprintf("%s/latest?access_key=%s&base=%s&symbols=%s",
+		s.baseURL, s.apiKey, from, to)
+
+	reqCtx := ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
 
-	resp, err := s.httpClient.Get(url)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
 	if err != nil {
-		// Fallback при ошибке сети
+		return 0, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		// Fallback при ошибке сети или медленном ответе
 		return s.getFallbackRate(from, to), nil
 	}
 	defer resp.Body.Close()
@@ -0,0 +1,99 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// hangingFixer — Fixer.io, который не отвечает, пока клиент не оборвёт запрос.
+// started закрывается, когда запрос дошёл до сервера, cancelled — когда сервер увидел отмену
+type hangingFixer struct {
+	*httptest.Server
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func newHangingFixer(t *testing.T) *hangingFixer {
+	t.Helper()
+	f := &hangingFixer{started: make(chan struct{}), cancelled: make(chan struct{})}
+	var once sync.Once
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		once.Do(func() { close(f.started) })
+		<-r.Context().Done()
+		close(f.cancelled)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *hangingFixer) assertCancelled(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Fixer request was not cancelled")
+	}
+}
+
+func newTestService(t *testing.T, baseURL string, timeout time.Duration) *Service {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	s := NewService("test-key", rdb, timeout)
+	s.baseURL = baseURL
+	return s
+}
+
+func TestConvertToRUBDeadlineCancelsFixer(t *testing.T) {
+	fixer := newHangingFixer(t)
+	s := newTestService(t, fixer.URL, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.ConvertToRUB(ctx, 100, "USD"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ConvertToRUB error = %v, want deadline exceeded", err)
+	}
+	fixer.assertCancelled(t)
+}
+
+func TestConvertToRUBDisconnectCancelsFixer(t *testing.T) {
+	fixer := newHangingFixer(t)
+	s := newTestService(t, fixer.URL, time.Minute)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	go func() {
+		<-fixer.started
+		disconnect()
+	}()
+	if _, err := s.ConvertToRUB(ctx, 100, "USD"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ConvertToRUB error = %v, want context.Canceled", err)
+	}
+	fixer.assertCancelled(t)
+}
+
+func TestConvertToRUBOwnTimeoutFallsBack(t *testing.T) {
+	fixer := newHangingFixer(t)
+	s := newTestService(t, fixer.URL, 50*time.Millisecond)
+
+	// Медленный Fixer не должен валить запрос: берётся запасной курс
+	got, err := s.ConvertToRUB(context.Background(), 100, "USD")
+	if err != nil {
+		t.Fatalf("ConvertToRUB: %v", err)
+	}
+	if want := 100 * s.getFallbackRate("USD", "RUB"); got != want {
+		t.Fatalf("ConvertToRUB = %v, want fallback %v", got, want)
+	}
+	fixer.assertCancelled(t)
+}
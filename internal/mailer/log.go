@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer для разработки: вместо отправки пишет письма в лог
+// или дописывает их в файл, если указан путь
+type LogMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{path: path}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	text := fmt.Sprintf("=== %s ===\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+
+	if m.path == "" {
+		log.Printf("📧 Email (not sent):\n%s", text)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(text); err != nil {
+		return fmt.Errorf("failed to write mail log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Kir-Khorev/finopp-back/pkg/config"
+)
+
+// Поддерживаемые способы отправки писем
+const (
+	DriverSMTP = "smtp"
+	DriverLog  = "log"
+)
+
+// Message — простое текстовое письмо
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer отправляет письма пользователям
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создаёт отправителя, выбранного в конфигурации
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailDriver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom), nil
+	case DriverLog:
+		return NewLogMailer(cfg.MailLogFile), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %q", cfg.MailDriver)
+	}
+}
@@ -1,15 +1,80 @@
 package middleware
 
 import (
+	"context"
 	"strings"
+	"time"
 
 	"github.com/Kir-Khorev/finopp-back/pkg/errors"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
-// AuthMiddleware проверяет JWT токен
-func AuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
+// Principal — аутентифицированный владелец запроса
+type Principal struct {
+	UserID        int
+	Email         string
+	EmailVerified bool
+	Role          string
+	Permissions   []string  // права роли на момент выдачи токена
+	TokenID       string    // jti токена доступа
+	SessionID     string    // вход (устройство), к которому относится токен
+	ExpiresAt     time.Time // когда истекает токен доступа
+	// APIKeyID и Scopes заполняются при входе по персональному API-ключу
+	APIKeyID int
+	Scopes   []string
+}
+
+// Права персональных API-ключей. Вход по токену доступа даёт все права
+const (
+	ScopeAdviceWrite   = "advice:write"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+)
+
+// AllScopes — права, которые можно выдать API-ключу
+var AllScopes = []string{ScopeAdviceWrite, ScopeSessionsRead, ScopeSessionsWrite, ScopeProfileRead, ScopeProfileWrite}
+
+// HasScope сообщает, разрешено ли действие владельцу запроса
+func (p *Principal) HasScope(scope string) bool {
+	if p.APIKeyID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenVerifier проверяет учётные данные запроса: токен доступа
+// (подпись, срок действия и отзыв) или персональный API-ключ
+type TokenVerifier interface {
+	VerifyAccessToken(ctx context.Context, token string) (*Principal, error)
+	VerifyAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+// authenticate проверяет заголовок "Bearer <token>" или "ApiKey <key>"
+func authenticate(c echo.Context, verifier TokenVerifier, authHeader string) (*Principal, error) {
+	scheme, credentials, ok := strings.Cut(authHeader, " ")
+	if !ok || credentials == "" {
+		return nil, errors.ErrInvalidToken
+	}
+
+	switch scheme {
+	case "Bearer":
+		return verifier.VerifyAccessToken(c.Request().Context(), credentials)
+	case "ApiKey":
+		return verifier.VerifyAPIKey(c.Request().Context(), credentials)
+	default:
+		return nil, errors.ErrInvalidToken
+	}
+}
+
+// AuthMiddleware проверяет JWT токен или API-ключ
+func AuthMiddleware(verifier TokenVerifier) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
@@ -17,33 +82,31 @@ func AuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
 				return c.JSON(errors.ErrUnauthorized.Code, errors.ErrUnauthorized)
 			}
 
-			// Проверяем формат "Bearer <token>"
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
+			principal, err := authenticate(c, verifier, authHeader)
+			if err != nil {
+				if appErr, ok := err.(*errors.AppError); ok {
+					return c.JSON(appErr.Code, appErr)
+				}
 				return c.JSON(errors.ErrInvalidToken.Code, errors.ErrInvalidToken)
 			}
 
-			tokenString := parts[1]
-
-			// Парсим токен
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				// Проверяем метод подписи
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.ErrInvalidToken
-				}
-				return []byte(jwtSecret), nil
-			})
+			setPrincipal(c, principal)
+			return next(c)
+		}
+	}
+}
 
-			if err != nil || !token.Valid {
-				return c.JSON(errors.ErrInvalidToken.Code, errors.ErrInvalidToken)
+// OptionalAuthMiddleware проверяет токен если он есть, но не требует его
+func OptionalAuthMiddleware(verifier TokenVerifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authHeader := c.Request().Header.Get("Authorization")
+			if authHeader == "" {
+				return next(c)
 			}
 
-			// Извлекаем claims
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				c.Set("user_id", int(claims["user_id"].(float64)))
-				c.Set("email", claims["email"].(string))
-			} else {
-				return c.JSON(errors.ErrInvalidToken.Code, errors.ErrInvalidToken)
+			if principal, err := authenticate(c, verifier, authHeader); err == nil {
+				setPrincipal(c, principal)
 			}
 
 			return next(c)
@@ -51,35 +114,61 @@ func AuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
 	}
 }
 
-// OptionalAuthMiddleware проверяет токен если он есть, но не требует его
-func OptionalAuthMiddleware(jwtSecret string) echo.MiddlewareFunc {
+// RequireVerifiedEmail пропускает только пользователей с подтверждённым email.
+// При enabled = false (политика отключена) ничего не проверяет.
+func RequireVerifiedEmail(enabled bool) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader == "" {
+			if !enabled {
 				return next(c)
 			}
+			principal := GetPrincipal(c)
+			if principal == nil {
+				return c.JSON(errors.ErrUnauthorized.Code, errors.ErrUnauthorized)
+			}
+			if !principal.EmailVerified {
+				return c.JSON(errors.ErrEmailNotVerified.Code, errors.ErrEmailNotVerified)
+			}
+			return next(c)
+		}
+	}
+}
 
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				tokenString := parts[1]
-				token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-					if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-						return nil, errors.ErrInvalidToken
-					}
-					return []byte(jwtSecret), nil
-				})
-
-				if err == nil && token.Valid {
-					if claims, ok := token.Claims.(jwt.MapClaims); ok {
-						c.Set("user_id", int(claims["user_id"].(float64)))
-						c.Set("email", claims["email"].(string))
-					}
-				}
+// RequireScope проверяет право API-ключа на действие. Анонимные запросы
+// пропускает: обязательность входа задаёт AuthMiddleware
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := GetPrincipal(c)
+			if principal != nil && !principal.HasScope(scope) {
+				return c.JSON(errors.ErrForbidden.Code, errors.ErrForbidden)
 			}
+			return next(c)
+		}
+	}
+}
 
+// RejectAPIKeys закрывает маршрут для API-ключей: управлять аккаунтом
+// и самими ключами можно только после обычного входа
+func RejectAPIKeys() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if principal := GetPrincipal(c); principal != nil && principal.APIKeyID != 0 {
+				return c.JSON(errors.ErrForbidden.Code, errors.ErrForbidden)
+			}
 			return next(c)
 		}
 	}
 }
 
+// GetPrincipal возвращает владельца запроса или nil для анонимного запроса
+func GetPrincipal(c echo.Context) *Principal {
+	principal, _ := c.Get("principal").(*Principal)
+	return principal
+}
+
+func setPrincipal(c echo.Context, principal *Principal) {
+	c.Set("principal", principal)
+	c.Set("user_id", principal.UserID)
+	c.Set("email", principal.Email)
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"strconv"
 
 	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
 	"github.com/labstack/echo/v4"
@@ -15,6 +16,9 @@ func ErrorHandler(err error, c echo.Context) {
 		if appErr.Code >= 500 {
 			log.Printf("Internal error: %v", appErr)
 		}
+		if appErr.RetryAfter > 0 {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(appErr.RetryAfter))
+		}
 		_ = c.JSON(appErr.Code, appErr)
 		return
 	}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// Роли пользователей
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Права администраторов; обычная роль user их не имеет
+const (
+	PermUsersRead    = "users:read"
+	PermUsersDisable = "users:disable"
+	PermUsersLogout  = "users:logout"
+	PermUsersRoles   = "users:roles"
+	PermStatsRead    = "stats:read"
+	PermAuditRead    = "audit:read"
+)
+
+var rolePermissions = map[string][]string{
+	RoleUser:    {},
+	RoleSupport: {PermUsersRead, PermUsersLogout, PermStatsRead},
+	RoleAdmin:   {PermUsersRead, PermUsersDisable, PermUsersLogout, PermUsersRoles, PermStatsRead, PermAuditRead},
+}
+
+// ValidRole сообщает, существует ли роль
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// PermissionsFor возвращает права роли; неизвестная роль прав не даёт
+func PermissionsFor(role string) []string {
+	return rolePermissions[role]
+}
+
+// HasPermission сообщает, есть ли у владельца запроса право.
+// API-ключи административных прав не получают никогда
+func (p *Principal) HasPermission(permission string) bool {
+	if p.APIKeyID != 0 {
+		return false
+	}
+	for _, perm := range p.Permissions {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission пропускает только владельцев запроса с нужным правом.
+// Ставится после AuthMiddleware
+func RequirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := GetPrincipal(c)
+			if principal == nil {
+				return c.JSON(errors.ErrUnauthorized.Code, errors.ErrUnauthorized)
+			}
+			if !principal.HasPermission(permission) {
+				return c.JSON(errors.ErrForbidden.Code, errors.ErrForbidden)
+			}
+			return next(c)
+		}
+	}
+}
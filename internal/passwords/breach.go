@@ -0,0 +1,127 @@
+package passwords
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BreachChecker сообщает, встречался ли пароль в известных утечках
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// RangeSource возвращает суффиксы SHA-1 хешей утёкших паролей, начинающихся
+// с prefix (5 hex-символов). Формат строк как у HIBP: "SUFFIX:COUNT"
+type RangeSource interface {
+	Range(ctx context.Context, prefix string) (io.ReadCloser, error)
+}
+
+// RangeChecker проверяет пароль по k-анонимной схеме: наружу уходят только
+// первые 5 символов SHA-1, сравнение суффиксов выполняется локально
+type RangeChecker struct {
+	source RangeSource
+}
+
+func NewRangeChecker(source RangeSource) *RangeChecker {
+	return &RangeChecker{source: source}
+}
+
+func (c *RangeChecker) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	body, err := c.source.Range(ctx, prefix)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		candidate, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Строки с нулевым счётчиком — дополнение (Add-Padding), а не утечка
+		if strings.EqualFold(candidate, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breach range %s: %w", prefix, err)
+	}
+	return false, nil
+}
+
+// HIBPBaseURL — API Have I Been Pwned для проверки паролей
+const HIBPBaseURL = "https://api.pwnedpasswords.com"
+
+// HIBPSource запрашивает диапазоны хешей у Pwned Passwords API
+type HIBPSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHIBPSource(baseURL string) *HIBPSource {
+	return &HIBPSource{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+func (s *HIBPSource) Range(ctx context.Context, prefix string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Дополнение скрывает по размеру ответа, какой диапазон запрашивался
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "finopp-back")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pwned passwords: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("pwned passwords returned status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// DirSource читает диапазоны из локального каталога: файл <PREFIX>.txt на каждый
+// префикс, как их сохраняет официальный PwnedPasswordsDownloader. Работает без сети
+type DirSource struct {
+	dir string
+}
+
+func NewDirSource(dir string) (*DirSource, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached passwords dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached passwords dir: %s is not a directory", dir)
+	}
+	return &DirSource{dir: dir}, nil
+}
+
+func (s *DirSource) Range(ctx context.Context, prefix string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, strings.ToUpper(prefix)+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		// Диапазона нет в выгрузке — значит, и совпадений нет
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breach range %s: %w", prefix, err)
+	}
+	return f, nil
+}
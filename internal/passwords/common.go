@@ -0,0 +1,32 @@
+package passwords
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// common_passwords.txt — самые популярные пароли из публичных утечек,
+// включая русскую раскладку; по одному в строке, в нижнем регистре
+//
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+func parseCommonPasswords(data string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = struct{}{}
+	}
+	return set
+}
+
+// isCommon сообщает, входит ли пароль в список распространённых (без учёта регистра)
+func isCommon(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
@@ -0,0 +1,37 @@
+package passwords
+
+import (
+	"fmt"
+
+	"github.com/Kir-Khorev/finopp-back/pkg/config"
+)
+
+// Режимы проверки паролей по утечкам
+const (
+	BreachCheckOff     = "off"
+	BreachCheckHIBP    = "hibp"    // Pwned Passwords API, k-анонимность
+	BreachCheckOffline = "offline" // локальная выгрузка Pwned Passwords
+)
+
+// New создаёт политику паролей по конфигурации
+func New(cfg *config.Config) (*Policy, error) {
+	var breaches BreachChecker
+	switch cfg.PasswordBreachCheck {
+	case BreachCheckOff, "":
+	case BreachCheckHIBP:
+		breaches = NewRangeChecker(NewHIBPSource(HIBPBaseURL))
+	case BreachCheckOffline:
+		source, err := NewDirSource(cfg.PasswordBreachDir)
+		if err != nil {
+			return nil, err
+		}
+		breaches = NewRangeChecker(source)
+	default:
+		return nil, fmt.Errorf("unknown password breach check: %q", cfg.PasswordBreachCheck)
+	}
+
+	return NewPolicy(Config{
+		MinLength:  cfg.PasswordMinLength,
+		MinClasses: cfg.PasswordMinClasses,
+	}, breaches), nil
+}
@@ -0,0 +1,137 @@
+package passwords
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// Правила политики паролей; передаются клиенту в поле rule
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleCharClasses  = "character_classes"
+	RuleCommon       = "common_password"
+	RulePersonalInfo = "personal_info"
+	RuleBreached     = "breached"
+)
+
+// MaxBytes — bcrypt учитывает только первые 72 байта пароля, остальное молча отбрасывает
+const MaxBytes = 72
+
+// Config — настраиваемые требования к паролю
+type Config struct {
+	MinLength  int // минимум символов
+	MinClasses int // сколько разных классов нужно: строчные, заглавные, цифры, прочие символы
+}
+
+// Policy проверяет новые пароли при регистрации, сбросе и смене пароля
+type Policy struct {
+	cfg      Config
+	breaches BreachChecker // nil — проверка по утечкам выключена
+}
+
+func NewPolicy(cfg Config, breaches BreachChecker) *Policy {
+	return &Policy{cfg: cfg, breaches: breaches}
+}
+
+// Validate возвращает ErrWeakPassword со списком нарушенных правил или nil.
+// personal — данные пользователя (email, имя), которые пароль не должен содержать
+func (p *Policy) Validate(ctx context.Context, password string, personal ...string) error {
+	violations := p.check(password, personal)
+
+	// Внешнюю проверку делаем, только если пароль прошёл остальные правила
+	if len(violations) == 0 && p.breaches != nil {
+		breached, err := p.breaches.Breached(ctx, password)
+		if err != nil {
+			// Недоступность сервиса утечек не должна мешать регистрации
+			log.Printf("Breached password check failed: %v", err)
+		} else if breached {
+			violations = append(violations, apperrors.Violation{
+				Rule:    RuleBreached,
+				Message: "Этот пароль встречался в утечках данных, выберите другой",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return apperrors.WithViolations(apperrors.ErrWeakPassword, violations)
+	}
+	return nil
+}
+
+func (p *Policy) check(password string, personal []string) []apperrors.Violation {
+	var violations []apperrors.Violation
+	add := func(rule, message string) {
+		violations = append(violations, apperrors.Violation{Rule: rule, Message: message})
+	}
+
+	if n := utf8.RuneCountInString(password); n < p.cfg.MinLength {
+		add(RuleMinLength, fmt.Sprintf("Пароль должен содержать минимум %d символов", p.cfg.MinLength))
+	}
+	if len(password) > MaxBytes {
+		add(RuleMaxLength, fmt.Sprintf("Пароль не должен быть длиннее %d байт (около %d латинских или %d русских букв)",
+			MaxBytes, MaxBytes, MaxBytes/2))
+	}
+	if classes := charClasses(password); classes < p.cfg.MinClasses {
+		add(RuleCharClasses, fmt.Sprintf("Используйте минимум %d из 4 типов символов: строчные и заглавные буквы, цифры, другие символы",
+			p.cfg.MinClasses))
+	}
+	if isCommon(password) {
+		add(RuleCommon, "Этот пароль слишком распространён")
+	}
+	if containsPersonal(password, personal) {
+		add(RulePersonalInfo, "Пароль не должен содержать ваш email или имя")
+	}
+
+	return violations
+}
+
+// charClasses считает, сколько классов символов встречается в пароле.
+// Буквы без регистра (например, иероглифы) считаются строчными
+func charClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLetter(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, has := range []bool{lower, upper, digit, other} {
+		if has {
+			count++
+		}
+	}
+	return count
+}
+
+// minPersonalLen — более короткие фрагменты (например, имя «Ян») не проверяем
+const minPersonalLen = 4
+
+func containsPersonal(password string, personal []string) bool {
+	lowered := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		// Для email проверяем имя ящика, домен сам по себе не секрет
+		if at := strings.LastIndex(value, "@"); at >= 0 {
+			value = value[:at]
+		}
+		if utf8.RuneCountInString(value) >= minPersonalLen && strings.Contains(lowered, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package profile
+
+import (
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) GetProfile(c echo.Context) error {
+	userID := c.Get("user_id").(int)
+
+	p, err := h.service.GetProfile(c.Request().Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, p)
+}
+
+// UpdateProfile сохраняет профиль. Клиент передаёт updatedAt из последнего GET;
+// если профиль успели изменить, вернётся 409 и данные нужно перечитать.
+func (h *Handler) UpdateProfile(c echo.Context) error {
+	var req UpdateProfileRequest
+	if err := c.Bind(&req); err != nil {
+		return apperrors.NewWithDetails(400, "Неверный формат запроса", err.Error())
+	}
+
+	userID := c.Get("user_id").(int)
+
+	p, err := h.service.UpdateProfile(c.Request().Context(), userID, req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, p)
+}
@@ -0,0 +1,24 @@
+package profile
+
+import "time"
+
+// Profile — финансовый профиль пользователя (таблица profiles)
+type Profile struct {
+	MonthlyIncome   float64 `json:"monthlyIncome"`
+	MonthlyExpenses float64 `json:"monthlyExpenses"`
+	SavingsGoal     float64 `json:"savingsGoal"`
+	DebtAmount      float64 `json:"debtAmount"`
+	Currency        string  `json:"currency"`
+	// UpdatedAt — версия профиля для оптимистичной блокировки; nil, если профиль ещё не сохранён
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
+
+type UpdateProfileRequest struct {
+	MonthlyIncome   float64 `json:"monthlyIncome"`
+	MonthlyExpenses float64 `json:"monthlyExpenses"`
+	SavingsGoal     float64 `json:"savingsGoal"`
+	DebtAmount      float64 `json:"debtAmount"`
+	Currency        string  `json:"currency"`
+	// UpdatedAt — значение из последнего GET; обязательно, если профиль уже существует
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,91 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrProfileNotFound — пользователь ещё не сохранял профиль
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrVersionConflict — профиль изменился после того, как клиент его прочитал
+	ErrVersionConflict = errors.New("profile version conflict")
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) GetByUserID(ctx context.Context, userID int) (*Profile, error) {
+	var p Profile
+	var updatedAt time.Time
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT monthly_income, monthly_expenses, savings_goal, debt_amount, currency, updated_at
+		 FROM profiles WHERE user_id = $1`,
+		userID,
+	).Scan(&p.MonthlyIncome, &p.MonthlyExpenses, &p.SavingsGoal, &p.DebtAmount, &p.Currency, &updatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile: %w", err)
+	}
+
+	p.UpdatedAt = &updatedAt
+	return &p, nil
+}
+
+// Create сохраняет первый профиль пользователя. Если профиль успел
+// создать параллельный запрос, возвращает ErrVersionConflict.
+func (r *Repository) Create(ctx context.Context, userID int, p Profile) (*Profile, error) {
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO profiles (user_id, monthly_income, monthly_expenses, savings_goal, debt_amount, currency)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (user_id) DO NOTHING
+		 RETURNING updated_at`,
+		userID, p.MonthlyIncome, p.MonthlyExpenses, p.SavingsGoal, p.DebtAmount, p.Currency,
+	).Scan(&updatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile: %w", err)
+	}
+
+	p.UpdatedAt = &updatedAt
+	return &p, nil
+}
+
+// Update обновляет профиль, только если его версия (updated_at) совпадает с expectedVersion
+func (r *Repository) Update(ctx context.Context, userID int, p Profile, expectedVersion time.Time) (*Profile, error) {
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE profiles
+		 SET monthly_income = $2, monthly_expenses = $3, savings_goal = $4, debt_amount = $5,
+		     currency = $6, updated_at = CURRENT_TIMESTAMP
+		 WHERE user_id = $1 AND updated_at = $7
+		 RETURNING updated_at`,
+		userID, p.MonthlyIncome, p.MonthlyExpenses, p.SavingsGoal, p.DebtAmount, p.Currency, expectedVersion,
+	).Scan(&updatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	p.UpdatedAt = &updatedAt
+	return &p, nil
+}
@@ -0,0 +1,121 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apperrors "github.com/Kir-Khorev/finopp-back/pkg/errors"
+)
+
+// maxAmount — предел колонок DECIMAL(10,2)
+const maxAmount = 99999999.99
+
+const defaultCurrency = "RUB"
+
+// supportedCurrencies — валюты, которые умеет конвертировать currency.Service
+var supportedCurrencies = map[string]bool{
+	"RUB": true,
+	"USD": true,
+	"EUR": true,
+	"KZT": true,
+	"AZN": true,
+}
+
+var ErrProfileConflict = apperrors.NewWithDetails(http.StatusConflict, "Профиль был изменён в другом окне",
+	"reload the profile and retry with the current updatedAt")
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// GetProfile возвращает профиль пользователя. Если профиль ещё не сохранён,
+// возвращает пустой профиль с UpdatedAt = nil.
+func (s *Service) GetProfile(ctx context.Context, userID int) (*Profile, error) {
+	p, err := s.repo.GetByUserID(ctx, userID)
+	if errors.Is(err, ErrProfileNotFound) {
+		return &Profile{Currency: defaultCurrency}, nil
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки профиля")
+	}
+	return p, nil
+}
+
+// UpdateProfile создаёт или обновляет профиль с проверкой версии
+func (s *Service) UpdateProfile(ctx context.Context, userID int, req UpdateProfileRequest) (*Profile, error) {
+	p, err := validate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.GetByUserID(ctx, userID)
+	if errors.Is(err, ErrProfileNotFound) {
+		created, err := s.repo.Create(ctx, userID, p)
+		if errors.Is(err, ErrVersionConflict) {
+			return nil, ErrProfileConflict
+		}
+		if err != nil {
+			return nil, apperrors.Wrap(err, "Ошибка сохранения профиля")
+		}
+		return created, nil
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка загрузки профиля")
+	}
+
+	if req.UpdatedAt == nil {
+		return nil, apperrors.NewWithDetails(http.StatusConflict, "Профиль уже существует",
+			fmt.Sprintf("updatedAt is required, current value: %s", current.UpdatedAt.Format("2006-01-02T15:04:05.999999Z07:00")))
+	}
+
+	updated, err := s.repo.Update(ctx, userID, p, *req.UpdatedAt)
+	if errors.Is(err, ErrVersionConflict) {
+		return nil, ErrProfileConflict
+	}
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Ошибка сохранения профиля")
+	}
+	return updated, nil
+}
+
+func validate(req UpdateProfileRequest) (Profile, error) {
+	amounts := []struct {
+		field string
+		value float64
+	}{
+		{"monthlyIncome", req.MonthlyIncome},
+		{"monthlyExpenses", req.MonthlyExpenses},
+		{"savingsGoal", req.SavingsGoal},
+		{"debtAmount", req.DebtAmount},
+	}
+	for _, a := range amounts {
+		if a.value < 0 || a.value > maxAmount {
+			return Profile{}, apperrors.NewWithDetails(400, "Некорректная сумма",
+				fmt.Sprintf("%s must be between 0 and %.2f", a.field, maxAmount))
+		}
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	if !supportedCurrencies[currency] {
+		return Profile{}, apperrors.NewWithDetails(400, "Валюта не поддерживается",
+			"currency must be one of RUB, USD, EUR, KZT, AZN")
+	}
+
+	return Profile{
+		MonthlyIncome:   req.MonthlyIncome,
+		MonthlyExpenses: req.MonthlyExpenses,
+		SavingsGoal:     req.SavingsGoal,
+		DebtAmount:      req.DebtAmount,
+		Currency:        currency,
+	}, nil
+}
@@ -1,12 +1,19 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret — секрет по умолчанию; в production с ним сервер не запустится
+const DefaultJWTSecret = "change-me-in-production"
+
 type Config struct {
 	Port          string
 	Environment   string
@@ -19,29 +26,146 @@ type Config struct {
 	RedisPort     string
 	RedisPassword string
 	JWTSecret     string
-	GroqAPIKey    string
-	FixerAPIKey   string
+	// JWTKeysDir — каталог с ключами <kid>.pem для RS256/EdDSA; пусто — HS256 с JWTSecret
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	JWTIssuer       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RequireVerifiedEmail: неподтверждённые пользователи могут войти,
+	// но не сохраняют профиль и историю консультаций
+	RequireVerifiedEmail bool
+	GroqAPIKey           string
+	FixerAPIKey          string
+	LLMProvider          string // groq, openai или fake
+	LLMBaseURL           string // для openai-совместимых серверов (Ollama, llama.cpp)
+	LLMAPIKey            string
+	LLMModel             string
+	AppBaseURL           string // адрес фронтенда для ссылок в письмах
+	MailDriver           string // smtp или log
+	MailFrom             string
+	MailLogFile          string // для log: файл вместо stdout
+	SMTPHost             string
+	SMTPPort             string
+	SMTPUser             string
+	SMTPPassword         string
+	// Социальный вход: провайдер включается, если задан его client id.
+	// Провайдер возвращает пользователя на OAUTH_REDIRECT_BASE_URL/oauth/<provider>/callback
+	OAuthRedirectBaseURL string
+	GoogleClientID       string
+	GoogleClientSecret   string
+	YandexClientID       string
+	YandexClientSecret   string
+	VKClientID           string
+	VKClientSecret       string
+	// AdminEmails получают роль admin при старте (через запятую)
+	AdminEmails []string
+	// AccountDeletionGrace — сколько можно отменить удаление аккаунта
+	AccountDeletionGrace time.Duration
+	// AuthEventsRetention — сколько хранится журнал входов (auth_events)
+	AuthEventsRetention time.Duration
+	// Политика паролей
+	PasswordMinLength   int
+	PasswordMinClasses  int    // из 4: строчные, заглавные, цифры, прочие символы
+	PasswordBreachCheck string // off, hibp или offline
+	PasswordBreachDir   string // для offline: каталог с файлами <PREFIX>.txt
+	// Повторы и автомат отключения для запросов к модели
+	LLMMaxRetries       int
+	LLMRetryMaxDelay    time.Duration // дольше не ждём, даже если API просит Retry-After
+	LLMBreakerThreshold int           // отказов подряд до размыкания; 0 — автомат выключен
+	LLMBreakerCooldown  time.Duration
+	// Бюджеты времени на ответ модели по эндпоинтам и на запрос курса валют
+	AdviceTimeout       time.Duration
+	AnalyzeTimeout      time.Duration
+	AdviceStreamTimeout time.Duration
+	CurrencyTimeout     time.Duration
+	// LLMTools: модель может вызывать калькуляторы (кредит, вклад, курс валют).
+	// Выключено по умолчанию: не все модели поддерживают tools
+	LLMTools bool
+	// TrustedProxies — прокси (CIDR), которым доверяем X-Forwarded-For; пусто — адрес соединения
+	TrustedProxies []string
 }
 
 func Load() *Config {
 	// Load .env file if exists
 	_ = godotenv.Load()
 
-	return &Config{
-		Port:          getEnv("PORT", "8080"),
-		Environment:   getEnv("ENV", "development"),
-		DBHost:        getEnv("DB_HOST", "localhost"),
-		DBPort:        getEnv("DB_PORT", "5432"),
-		DBUser:        getEnv("DB_USER", "finopp"),
-		DBPassword:    getEnv("DB_PASSWORD", "finopp_pass"),
-		DBName:        getEnv("DB_NAME", "finopp_db"),
-		RedisHost:     getEnv("REDIS_HOST", "localhost"),
-		RedisPort:     getEnv("REDIS_PORT", "6379"),
-		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		JWTSecret:     getEnv("JWT_SECRET", "change-me-in-production"),
-		GroqAPIKey:    getEnv("GROQ_API_KEY", ""),
-		FixerAPIKey:   getEnv("FIXER_API_KEY", ""),
+	cfg := &Config{
+		Port:                 getEnv("PORT", "8080"),
+		Environment:          getEnv("ENV", "development"),
+		DBHost:               getEnv("DB_HOST", "localhost"),
+		DBPort:               getEnv("DB_PORT", "5432"),
+		DBUser:               getEnv("DB_USER", "finopp"),
+		DBPassword:           getEnv("DB_PASSWORD", "finopp_pass"),
+		DBName:               getEnv("DB_NAME", "finopp_db"),
+		RedisHost:            getEnv("REDIS_HOST", "localhost"),
+		RedisPort:            getEnv("REDIS_PORT", "6379"),
+		RedisPassword:        getEnv("REDIS_PASSWORD", ""),
+		JWTSecret:            getEnv("JWT_SECRET", DefaultJWTSecret),
+		JWTKeysDir:           os.Getenv("JWT_KEYS_DIR"),
+		JWTSigningKeyID:      os.Getenv("JWT_SIGNING_KEY_ID"), // можно не задавать, если закрытый ключ один
+		JWTIssuer:            getEnv("JWT_ISSUER", "finopp"),
+		AccessTokenTTL:       getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:      getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		RequireVerifiedEmail: getEnvBool("REQUIRE_VERIFIED_EMAIL", true),
+		GroqAPIKey:           getEnv("GROQ_API_KEY", ""),
+		FixerAPIKey:          getEnv("FIXER_API_KEY", ""),
+		LLMProvider:          getEnv("LLM_PROVIDER", "groq"),
+		LLMBaseURL:           getEnv("LLM_BASE_URL", "http://localhost:11434/v1"),
+		LLMAPIKey:            os.Getenv("LLM_API_KEY"), // локальным серверам ключ не нужен
+		LLMModel:             getEnv("LLM_MODEL", "llama-3.3-70b-versatile"),
+		LLMMaxRetries:        getEnvInt("LLM_MAX_RETRIES", 2),
+		LLMRetryMaxDelay:     getEnvDuration("LLM_RETRY_MAX_DELAY", 10*time.Second),
+		LLMBreakerThreshold:  getEnvInt("LLM_BREAKER_THRESHOLD", 5),
+		LLMBreakerCooldown:   getEnvDuration("LLM_BREAKER_COOLDOWN", 30*time.Second),
+		AdviceTimeout:        getEnvDuration("ADVICE_TIMEOUT", 45*time.Second),
+		AnalyzeTimeout:       getEnvDuration("ANALYZE_TIMEOUT", 60*time.Second),
+		AdviceStreamTimeout:  getEnvDuration("ADVICE_STREAM_TIMEOUT", 2*time.Minute),
+		CurrencyTimeout:      getEnvDuration("CURRENCY_TIMEOUT", 5*time.Second),
+		LLMTools:             getEnvBool("LLM_TOOLS", false),
+		AppBaseURL:           getEnv("APP_BASE_URL", "http://localhost:5173"),
+		MailDriver:           getEnv("MAIL_DRIVER", "log"),
+		MailFrom:             getEnv("MAIL_FROM", "Finopp <no-reply@servify.digital>"),
+		MailLogFile:          os.Getenv("MAIL_LOG_FILE"),
+		SMTPHost:             getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:             getEnv("SMTP_PORT", "1025"),
+		SMTPUser:             os.Getenv("SMTP_USER"),
+		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		OAuthRedirectBaseURL: os.Getenv("OAUTH_REDIRECT_BASE_URL"),
+		GoogleClientID:       os.Getenv("GOOGLE_CLIENT_ID"),
+		GoogleClientSecret:   os.Getenv("GOOGLE_CLIENT_SECRET"),
+		YandexClientID:       os.Getenv("YANDEX_CLIENT_ID"),
+		YandexClientSecret:   os.Getenv("YANDEX_CLIENT_SECRET"),
+		VKClientID:           os.Getenv("VK_CLIENT_ID"),
+		VKClientSecret:       os.Getenv("VK_CLIENT_SECRET"),
+		AdminEmails:          getEnvList("ADMIN_EMAILS"),
+		AccountDeletionGrace: getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AuthEventsRetention:  getEnvDuration("AUTH_EVENTS_RETENTION", 90*24*time.Hour),
+		PasswordMinLength:    getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinClasses:   getEnvInt("PASSWORD_MIN_CLASSES", 2),
+		PasswordBreachCheck:  getEnv("PASSWORD_BREACH_CHECK", "off"),
+		PasswordBreachDir:    os.Getenv("PASSWORD_BREACH_DIR"),
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES"),
+	}
+
+	// По умолчанию провайдеры возвращают пользователя на фронтенд
+	if cfg.OAuthRedirectBaseURL == "" {
+		cfg.OAuthRedirectBaseURL = cfg.AppBaseURL
 	}
+
+	return cfg
+}
+
+// Validate проверяет настройки, без которых запускать сервер небезопасно
+func (c *Config) Validate() error {
+	if c.Environment == "production" && c.JWTKeysDir == "" && c.JWTSecret == DefaultJWTSecret {
+		return errors.New("в production нужно задать JWT_SECRET или JWT_KEYS_DIR")
+	}
+	// Драйвер log пишет ссылки сброса пароля и подтверждения в лог открытым текстом
+	if c.Environment == "production" && c.MailDriver == "log" {
+		return errors.New("в production нужен MAIL_DRIVER=smtp: драйвер log печатает токены из писем в лог")
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -54,3 +178,52 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList разбирает список через запятую, пустые элементы пропускаются
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
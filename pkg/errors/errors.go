@@ -2,7 +2,9 @@ package errors
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"time"
 )
 
 // AppError представляет структурированную ошибку приложения
@@ -10,6 +12,16 @@ type AppError struct {
 	Code    int    `json:"-"`
 	Message string `json:"error"`
 	Details string `json:"details,omitempty"`
+	// RetryAfter — через сколько секунд можно повторить запрос (уходит и в заголовок Retry-After)
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Violations перечисляет нарушенные правила (например, требования к паролю)
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation — одно нарушенное правило валидации
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 func (e *AppError) Error() string {
@@ -28,9 +40,12 @@ var (
 	ErrInternalServer      = &AppError{Code: http.StatusInternalServerError, Message: "Внутренняя ошибка сервера"}
 	ErrInvalidCredentials  = &AppError{Code: http.StatusUnauthorized, Message: "Неверный email или пароль"}
 	ErrEmailExists         = &AppError{Code: http.StatusConflict, Message: "Email уже зарегистрирован"}
-	ErrWeakPassword        = &AppError{Code: http.StatusBadRequest, Message: "Пароль должен содержать минимум 6 символов"}
+	ErrWeakPassword        = &AppError{Code: http.StatusBadRequest, Message: "Пароль не соответствует требованиям"}
 	ErrInvalidToken        = &AppError{Code: http.StatusUnauthorized, Message: "Невалидный токен"}
 	ErrGroqAPIUnavailable  = &AppError{Code: http.StatusServiceUnavailable, Message: "AI сервис временно недоступен"}
+	ErrTooManyRequests     = &AppError{Code: http.StatusTooManyRequests, Message: "Слишком много запросов, попробуйте позже"}
+	ErrEmailNotVerified    = &AppError{Code: http.StatusForbidden, Message: "Подтвердите email, чтобы сохранять данные"}
+	ErrAccountLocked       = &AppError{Code: http.StatusTooManyRequests, Message: "Слишком много неудачных попыток входа. Попробуйте позже или восстановите пароль"}
 )
 
 // New создаёт новую ошибку приложения
@@ -59,3 +74,16 @@ func Wrap(err error, message string) *AppError {
 	}
 }
 
+// WithRetryAfter возвращает копию ошибки с указанием, когда можно повторить запрос
+func WithRetryAfter(err *AppError, d time.Duration) *AppError {
+	copied := *err
+	copied.RetryAfter = int(math.Ceil(d.Seconds()))
+	return &copied
+}
+
+// WithViolations возвращает копию ошибки со списком нарушенных правил
+func WithViolations(err *AppError, violations []Violation) *AppError {
+	copied := *err
+	copied.Violations = violations
+	return &copied
+}